@@ -0,0 +1,234 @@
+package propolis
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"image"
+	// registering the decoders of the usual cover formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/go-flac/flacpicture"
+	goflac "github.com/go-flac/go-flac"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	minEmbeddedArtworkSize = 500
+	pictureIsURL           = "-->"
+)
+
+// mimeTypesByFormat, using the format names of the image package.
+var mimeTypesByFormat = map[string][]string{
+	"jpeg": {"image/jpeg", "image/jpg"},
+	"png":  {"image/png"},
+	"gif":  {"image/gif"},
+}
+
+// embeddedArtwork is a picture block found in a track.
+type embeddedArtwork struct {
+	track   string
+	picture *flacpicture.MetadataBlockPicture
+	// format, width and height as found by actually decoding the image data
+	format string
+	width  int
+	height int
+	hash   uint64
+	md5    string
+	err    error
+}
+
+func (a *embeddedArtwork) String() string {
+	return fmt.Sprintf("%s: picture type %d, %s", a.track, a.picture.PictureType, a.picture.MIME)
+}
+
+func (a *embeddedArtwork) isFrontCover() bool {
+	return a.picture.PictureType == flacpicture.PictureTypeFrontCover
+}
+
+// readMetadataBlocks of a FLAC file, without reading the audio frames.
+func readMetadataBlocks(path string) ([]*goflac.MetaDataBlock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := goflac.ParseMetadata(f)
+	if err != nil {
+		return nil, err
+	}
+	return file.Meta, nil
+}
+
+// getEmbeddedArtwork of all tracks, jobs at a time, decoding every picture.
+// Pictures are returned in track order.
+func getEmbeddedArtwork(flacs []*flac.Flac, jobs int) ([]*embeddedArtwork, error) {
+	trackArtwork := make([][]*embeddedArtwork, len(flacs))
+	errs := make([]error, len(flacs))
+	runInParallel(jobs, len(flacs), func(i int) {
+		trackArtwork[i], errs[i] = getTrackArtwork(flacs[i])
+	})
+	var artwork []*embeddedArtwork
+	for i := range flacs {
+		artwork = append(artwork, trackArtwork[i]...)
+		if errs[i] != nil {
+			return artwork, errs[i]
+		}
+	}
+	return artwork, nil
+}
+
+func getTrackArtwork(f *flac.Flac) ([]*embeddedArtwork, error) {
+	var artwork []*embeddedArtwork
+	if !f.HasCover {
+		return artwork, nil
+	}
+	blocks, err := readMetadataBlocks(f.Path)
+	if err != nil {
+		return artwork, err
+	}
+	for _, b := range blocks {
+		if b.Type != goflac.Picture {
+			continue
+		}
+		pic, err := flacpicture.ParseFromMetaDataBlock(*b)
+		if err != nil {
+			return artwork, fmt.Errorf("%s: %w", filepath.Base(f.Path), err)
+		}
+		artwork = append(artwork, decodeEmbeddedArtwork(filepath.Base(f.Path), pic))
+	}
+	return artwork, nil
+}
+
+func decodeEmbeddedArtwork(track string, pic *flacpicture.MetadataBlockPicture) *embeddedArtwork {
+	a := &embeddedArtwork{track: track, picture: pic}
+	hash := md5.Sum(pic.ImageData)
+	a.md5 = hex.EncodeToString(hash[:])
+	if pic.MIME == pictureIsURL {
+		return a
+	}
+	img, format, err := decodeImage(pic.ImageData)
+	if err != nil {
+		a.err = err
+		return a
+	}
+	a.format = format
+	a.width, a.height = img.Bounds().Dx(), img.Bounds().Dy()
+	a.hash = differenceHash(img)
+	return a
+}
+
+// decodeImage completely, to make sure the data is not corrupt, with any registered decoder.
+func decodeImage(data []byte) (image.Image, string, error) {
+	return image.Decode(bytes.NewReader(data))
+}
+
+// findTracksWithoutFrontCover among tracks with embedded artwork.
+func findTracksWithoutFrontCover(artwork []*embeddedArtwork) []string {
+	var withArtwork, withFrontCover []string
+	for _, a := range artwork {
+		withArtwork = append(withArtwork, a.track)
+		if a.isFrontCover() {
+			withFrontCover = append(withFrontCover, a.track)
+		}
+	}
+	strslice.RemoveDuplicates(&withArtwork)
+	var problems []string
+	for _, t := range withArtwork {
+		if !strslice.Contains(withFrontCover, t) {
+			problems = append(problems, t)
+		}
+	}
+	return problems
+}
+
+// findArtworkMIMEMismatches between the declared MIME type and the actual image format.
+func findArtworkMIMEMismatches(artwork []*embeddedArtwork) []string {
+	var problems []string
+	for _, a := range artwork {
+		switch {
+		case a.picture.MIME == pictureIsURL:
+			problems = append(problems, a.String()+": picture is a link to "+string(a.picture.ImageData))
+		case a.err != nil:
+			// will be reported as corrupt
+			continue
+		case !strslice.ContainsCaseInsensitive(mimeTypesByFormat[a.format], a.picture.MIME):
+			problems = append(problems, fmt.Sprintf("%s: actual format is %s", a.String(), a.format))
+		}
+	}
+	return problems
+}
+
+// findArtworkDimensionProblems: small artwork, or dimensions not matching what the picture block declares.
+func findArtworkDimensionProblems(artwork []*embeddedArtwork) []string {
+	var problems []string
+	for _, a := range artwork {
+		if a.err != nil || a.picture.MIME == pictureIsURL {
+			continue
+		}
+		if (a.picture.Width != 0 || a.picture.Height != 0) && (int(a.picture.Width) != a.width || int(a.picture.Height) != a.height) {
+			problems = append(problems, fmt.Sprintf("%s: declared as %dx%d, actually %dx%d", a.String(), a.picture.Width, a.picture.Height, a.width, a.height))
+		}
+		if a.isFrontCover() && (a.width < minEmbeddedArtworkSize || a.height < minEmbeddedArtworkSize) {
+			problems = append(problems, fmt.Sprintf("%s: front cover is only %dx%d", a.String(), a.width, a.height))
+		}
+	}
+	return problems
+}
+
+// findCorruptArtwork that cannot be decoded.
+func findCorruptArtwork(artwork []*embeddedArtwork) []string {
+	var problems []string
+	for _, a := range artwork {
+		if a.err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", a.String(), a.err.Error()))
+		}
+	}
+	return problems
+}
+
+// findDifferentFrontCovers returns one track per distinct front cover, if there are more than one.
+func findDifferentFrontCovers(artwork []*embeddedArtwork) []string {
+	var hashes, tracks []string
+	for _, a := range artwork {
+		if a.isFrontCover() && !strslice.Contains(hashes, a.md5) {
+			hashes = append(hashes, a.md5)
+			tracks = append(tracks, fmt.Sprintf("%s: front cover #%d (%dx%d, %dKiB)", a.track, len(hashes), a.width, a.height, len(a.picture.ImageData)/1024))
+		}
+	}
+	if len(hashes) <= 1 {
+		return []string{}
+	}
+	return tracks
+}
+
+// largestFrontCover among all tracks, nil if none was found.
+func largestFrontCover(artwork []*embeddedArtwork) *embeddedArtwork {
+	var largest *embeddedArtwork
+	for _, a := range artwork {
+		if a.isFrontCover() && a.err == nil && (largest == nil || a.width*a.height > largest.width*largest.height) {
+			largest = a
+		}
+	}
+	return largest
+}
+
+// getImageSize without decoding the whole image.
+func getImageSize(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
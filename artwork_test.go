@@ -0,0 +1,119 @@
+package propolis
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/go-flac/flacpicture"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+)
+
+// gradient is a test picture, diagonal if inverted is set so that it looks different.
+func gradient(inverted bool) func(x, y, w, h int) color.Color {
+	return func(x, y, w, h int) color.Color {
+		v := uint8(255 * x / w)
+		if inverted {
+			v = uint8(255 * (x + y) / (w + h))
+			v = 255 - v
+		}
+		return color.Gray{Y: v}
+	}
+}
+
+// encodeTestImage of a given size, in the format of the image package.
+func encodeTestImage(t *testing.T, format string, width, height int, pixel func(x, y, w, h int) color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, pixel(x, y, width, height))
+		}
+	}
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buffer, img, nil)
+	case "png":
+		err = png.Encode(&buffer, img)
+	case "gif":
+		err = gif.Encode(&buffer, img, nil)
+	case "bmp":
+		err = bmp.Encode(&buffer, img)
+	default:
+		t.Fatal("unsupported test image format " + format)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestEmbeddedArtwork(t *testing.T) {
+	fmt.Println("+ Testing embedded artwork...")
+	check := assert.New(t)
+
+	png600 := encodeTestImage(t, "png", 600, 600, gradient(false))
+	jpeg600 := encodeTestImage(t, "jpeg", 600, 600, gradient(false))
+	gif200 := encodeTestImage(t, "gif", 200, 200, gradient(true))
+	picture := func(pictureType flacpicture.PictureType, mime string, width, height uint32, data []byte) *flacpicture.MetadataBlockPicture {
+		return &flacpicture.MetadataBlockPicture{PictureType: pictureType, MIME: mime, Width: width, Height: height, ImageData: data}
+	}
+
+	artwork := []*embeddedArtwork{
+		decodeEmbeddedArtwork("01.flac", picture(flacpicture.PictureTypeFrontCover, "image/png", 600, 600, png600)),
+		// image/jpg is common, and accepted
+		decodeEmbeddedArtwork("02.flac", picture(flacpicture.PictureTypeFrontCover, "image/JPG", 0, 0, jpeg600)),
+		// wrong MIME type and dimensions
+		decodeEmbeddedArtwork("03.flac", picture(flacpicture.PictureTypeFrontCover, "image/jpeg", 500, 500, png600)),
+		// small, but not a front cover
+		decodeEmbeddedArtwork("03.flac", picture(flacpicture.PictureTypeBackCover, "image/gif", 200, 200, gif200)),
+		// small front cover
+		decodeEmbeddedArtwork("04.flac", picture(flacpicture.PictureTypeFrontCover, "image/gif", 200, 200, gif200)),
+		// truncated, and not an image at all
+		decodeEmbeddedArtwork("05.flac", picture(flacpicture.PictureTypeFrontCover, "image/png", 600, 600, png600[:len(png600)/2])),
+		decodeEmbeddedArtwork("06.flac", picture(flacpicture.PictureTypeFrontCover, "image/png", 600, 600, []byte("not an image"))),
+		// link instead of a picture
+		decodeEmbeddedArtwork("07.flac", picture(flacpicture.PictureTypeBackCover, pictureIsURL, 0, 0, []byte("http://example.com/cover.jpg"))),
+	}
+	check.Equal("png", artwork[0].format)
+	check.Equal(600, artwork[0].width)
+	check.Equal(600, artwork[0].height)
+	check.Equal("jpeg", artwork[1].format)
+	check.Nil(artwork[1].err)
+
+	check.Equal([]string{
+		"03.flac: picture type 3, image/jpeg: actual format is png",
+		"07.flac: picture type 4, -->: picture is a link to http://example.com/cover.jpg",
+	}, findArtworkMIMEMismatches(artwork))
+	check.Equal([]string{
+		"03.flac: picture type 3, image/jpeg: declared as 500x500, actually 600x600",
+		"04.flac: picture type 3, image/gif: front cover is only 200x200",
+	}, findArtworkDimensionProblems(artwork))
+	corrupt := findCorruptArtwork(artwork)
+	if check.Equal(2, len(corrupt)) {
+		check.Contains(corrupt[0], "05.flac: picture type 3, image/png: ")
+		check.Equal("06.flac: picture type 3, image/png: image: unknown format", corrupt[1])
+	}
+	check.Equal([]string{"07.flac"}, findTracksWithoutFrontCover(artwork))
+
+	// any registered format is decoded
+	bmpArtwork := decodeEmbeddedArtwork("08.flac", picture(flacpicture.PictureTypeFrontCover, "image/jpeg", 600, 600, encodeTestImage(t, "bmp", 600, 600, gradient(false))))
+	check.Nil(bmpArtwork.err)
+	check.Equal([]string{"08.flac: picture type 3, image/jpeg: actual format is bmp"}, findArtworkMIMEMismatches([]*embeddedArtwork{bmpArtwork}))
+	check.Equal(artwork[0], largestFrontCover(artwork))
+	check.Nil(largestFrontCover(artwork[3:4]))
+
+	// the same picture in every track is fine
+	check.Empty(findDifferentFrontCovers([]*embeddedArtwork{artwork[0], artwork[2]}))
+	check.Equal([]string{
+		fmt.Sprintf("01.flac: front cover #1 (600x600, %dKiB)", len(png600)/1024),
+		fmt.Sprintf("02.flac: front cover #2 (600x600, %dKiB)", len(jpeg600)/1024),
+	}, findDifferentFrontCovers(artwork[:2]))
+}
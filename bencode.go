@@ -0,0 +1,148 @@
+package propolis
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// bencode values, as used in .torrent files: strings, integers, lists and dictionaries with sorted keys.
+func bencode(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		buffer.WriteString(strconv.Itoa(len(v)) + ":" + v)
+	case []byte:
+		buffer.WriteString(strconv.Itoa(len(v)) + ":")
+		buffer.Write(v)
+	case int:
+		buffer.WriteString("i" + strconv.Itoa(v) + "e")
+	case int64:
+		buffer.WriteString("i" + strconv.FormatInt(v, 10) + "e")
+	case []interface{}:
+		buffer.WriteByte('l')
+		for _, e := range v {
+			if err := bencode(buffer, e); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('e')
+	case []string:
+		buffer.WriteByte('l')
+		for _, e := range v {
+			if err := bencode(buffer, e); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buffer.WriteByte('d')
+		for _, k := range keys {
+			if err := bencode(buffer, k); err != nil {
+				return err
+			}
+			if err := bencode(buffer, v[k]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('e')
+	default:
+		return errors.New(fmt.Sprintf("cannot bencode %T", value))
+	}
+	return nil
+}
+
+// bdecoder reads bencoded values, and remembers where the top-level "info" dictionary is, to compute info-hashes.
+type bdecoder struct {
+	data      []byte
+	pos       int
+	depth     int
+	infoStart int
+	infoEnd   int
+}
+
+func (d *bdecoder) decode() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, errors.New("unexpected end of bencoded data")
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		end := bytes.IndexByte(d.data[d.pos:], 'e')
+		if end == -1 {
+			return nil, errors.New("unterminated bencoded integer")
+		}
+		value, err := strconv.ParseInt(string(d.data[d.pos+1:d.pos+end]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		d.pos += end + 1
+		return value, nil
+	case c == 'l':
+		d.pos++
+		d.depth++
+		list := []interface{}{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			value, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		if d.pos >= len(d.data) {
+			return nil, errors.New("unterminated bencoded list")
+		}
+		d.pos++
+		d.depth--
+		return list, nil
+	case c == 'd':
+		d.pos++
+		d.depth++
+		dict := make(map[string]interface{})
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			key, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, errors.New("bencoded dictionary keys must be strings")
+			}
+			start := d.pos
+			value, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			if d.depth == 1 && k == "info" {
+				d.infoStart, d.infoEnd = start, d.pos
+			}
+			dict[k] = value
+		}
+		if d.pos >= len(d.data) {
+			return nil, errors.New("unterminated bencoded dictionary")
+		}
+		d.pos++
+		d.depth--
+		return dict, nil
+	case c >= '0' && c <= '9':
+		colon := bytes.IndexByte(d.data[d.pos:], ':')
+		if colon == -1 {
+			return nil, errors.New("invalid bencoded string")
+		}
+		length, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+		// comparing with what is left, adding to the position could overflow
+		if err != nil || length < 0 || length > len(d.data)-d.pos-colon-1 {
+			return nil, errors.New("invalid bencoded string length")
+		}
+		d.pos += colon + 1 + length
+		return string(d.data[d.pos-length : d.pos]), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("invalid bencoded data at %d", d.pos))
+	}
+}
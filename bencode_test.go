@@ -0,0 +1,87 @@
+package propolis
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBencode(t *testing.T) {
+	fmt.Println("+ Testing bencode...")
+	check := assert.New(t)
+
+	cases := []struct {
+		value   interface{}
+		encoded string
+		decoded interface{}
+	}{
+		{"spam", "4:spam", "spam"},
+		{"", "0:", ""},
+		{[]byte{0, 'e', 0xFF}, "3:\x00e\xff", "\x00e\xff"},
+		{42, "i42e", int64(42)},
+		{int64(-3), "i-3e", int64(-3)},
+		{0, "i0e", int64(0)},
+		{[]string{"a", "bc"}, "l1:a2:bce", []interface{}{"a", "bc"}},
+		{[]interface{}{}, "le", []interface{}{}},
+		{[]interface{}{1, "x", []interface{}{2}}, "li1e1:xli2eee", []interface{}{int64(1), "x", []interface{}{int64(2)}}},
+		{
+			map[string]interface{}{"zz": 1, "a": "b", "m": map[string]interface{}{}},
+			"d1:a1:b1:mde2:zzi1ee",
+			map[string]interface{}{"zz": int64(1), "a": "b", "m": map[string]interface{}{}},
+		},
+	}
+	for _, c := range cases {
+		var buffer bytes.Buffer
+		check.Nil(bencode(&buffer, c.value))
+		check.Equal(c.encoded, buffer.String())
+
+		d := &bdecoder{data: buffer.Bytes()}
+		decoded, err := d.decode()
+		check.Nil(err)
+		check.Equal(c.decoded, decoded)
+		check.Equal(len(c.encoded), d.pos)
+
+		// decoding then encoding again gives the same data
+		var again bytes.Buffer
+		check.Nil(bencode(&again, decoded))
+		check.Equal(c.encoded, again.String())
+	}
+
+	var buffer bytes.Buffer
+	check.NotNil(bencode(&buffer, 1.5))
+	check.NotNil(bencode(&buffer, map[string]interface{}{"a": true}))
+}
+
+func TestBdecoder(t *testing.T) {
+	fmt.Println("+ Testing bdecoder...")
+	check := assert.New(t)
+
+	// the info dictionary is only remembered at the top level
+	data := "d8:announce3:url4:infod4:infoi1e4:name1:xee"
+	d := &bdecoder{data: []byte(data)}
+	_, err := d.decode()
+	check.Nil(err)
+	check.Equal("d4:infoi1e4:name1:xe", data[d.infoStart:d.infoEnd])
+
+	invalid := []string{
+		"",
+		"i12",
+		"iae",
+		"l1:a",
+		"d1:a",
+		"di1ei2ee",
+		"5:abc",
+		"1x",
+		"x",
+		// lengths that would overflow the position
+		"9223372036854775807:a",
+		"d4:info9223372036854775800:ae",
+	}
+	for _, i := range invalid {
+		d := &bdecoder{data: []byte(i)}
+		_, err := d.decode()
+		check.NotNil(err, i)
+	}
+}
@@ -0,0 +1,314 @@
+package propolis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/fs"
+)
+
+const (
+	cacheFile = "propolis_cache.json"
+	// cacheMaxAge of entries for tracks that were not analysed again.
+	cacheMaxAge = 90 * 24 * time.Hour
+	// cacheLockTimeout is how long to wait for another run to save the cache; older locks were left by crashed runs.
+	cacheLockTimeout = 10 * time.Second
+	cacheLockRetry   = 100 * time.Millisecond
+)
+
+// cachedTrack holds the results of the expensive per-track analysis, and where its spectrograms were last saved.
+type cachedTrack struct {
+	MD5               string `json:"md5"`
+	MD5Unset          bool   `json:"md5_unset"`
+	ExpectedSamples   uint64 `json:"expected_samples"`
+	DecodedMD5        string `json:"decoded_md5"`
+	DecodedSamples    uint64 `json:"decoded_samples"`
+	DecodedFrames     int    `json:"decoded_frames"`
+	DecodeError       string `json:"decode_error,omitempty"`
+	ErrorOffset       int64  `json:"error_offset,omitempty"`
+	Truncated         bool   `json:"truncated"`
+	Subframes         int    `json:"subframes"`
+	VerbatimSubframes int    `json:"verbatim_subframes"`
+	NonSilentSamples  uint64 `json:"non_silent_samples"`
+	IdenticalSamples  uint64 `json:"identical_samples"`
+	InvertedSamples   uint64 `json:"inverted_samples"`
+	ChannelsCompared  bool   `json:"channels_compared"`
+	FlacTested        bool   `json:"flac_tested"`
+	FlacError         string `json:"flac_error,omitempty"`
+	Decoded           bool   `json:"decoded"`
+	MQAChecked        bool   `json:"mqa_checked"`
+	MQASyncword       bool   `json:"mqa_syncword"`
+	PaddedBitsChecked bool   `json:"padded_bits_checked"`
+	PaddedBits        bool   `json:"padded_bits"`
+	TrueBitDepth      int    `json:"true_bit_depth"`
+	Spectrogram       string `json:"spectrogram,omitempty"`
+	// LastUsed is when the track was last analysed, as a Unix timestamp.
+	LastUsed int64 `json:"last_used"`
+}
+
+func (c *cachedTrack) setIntegrity(t *trackIntegrity) {
+	c.Decoded = true
+	c.MD5, c.MD5Unset, c.ExpectedSamples = t.md5, t.md5Unset, t.expectedSamples
+	c.DecodedMD5, c.DecodedSamples, c.DecodedFrames = t.decodedMD5, t.decodedSamples, t.decodedFrames
+	c.Truncated, c.Subframes, c.VerbatimSubframes = t.truncated, t.subframes, t.verbatimSubframes
+	c.NonSilentSamples, c.IdenticalSamples, c.InvertedSamples = t.channels.nonSilent, t.channels.identical, t.channels.inverted
+	c.ChannelsCompared = true
+	c.DecodeError, c.ErrorOffset, c.FlacError = "", t.errorOffset, ""
+	if t.decodeErr != nil {
+		c.DecodeError = t.decodeErr.Error()
+	}
+	if t.flacErr != nil {
+		c.FlacError = t.flacErr.Error()
+	}
+}
+
+func (c *cachedTrack) integrity(track string) *trackIntegrity {
+	t := &trackIntegrity{
+		track:             track,
+		md5:               c.MD5,
+		md5Unset:          c.MD5Unset,
+		expectedSamples:   c.ExpectedSamples,
+		decodedMD5:        c.DecodedMD5,
+		decodedSamples:    c.DecodedSamples,
+		decodedFrames:     c.DecodedFrames,
+		truncated:         c.Truncated,
+		errorOffset:       c.ErrorOffset,
+		subframes:         c.Subframes,
+		verbatimSubframes: c.VerbatimSubframes,
+		channels:          channelStats{nonSilent: c.NonSilentSamples, identical: c.IdenticalSamples, inverted: c.InvertedSamples},
+	}
+	if c.DecodeError != "" {
+		t.decodeErr = errors.New(c.DecodeError)
+	}
+	if c.FlacError != "" {
+		t.flacErr = errors.New(c.FlacError)
+	}
+	return t
+}
+
+// analysisCache of per-track results, persisted as JSON and shared by all releases in a metadata root.
+// A nil *analysisCache is valid and caches nothing.
+type analysisCache struct {
+	sync.Mutex
+	path    string
+	Version string                  `json:"version"`
+	Tracks  map[string]*cachedTrack `json:"tracks"`
+	// MusicBrainz release lookups, by release ID.
+	MusicBrainz map[string]json.RawMessage `json:"musicbrainz,omitempty"`
+	// updated tracks, that have more recent results than what other runs may have saved.
+	updated map[string]bool
+}
+
+// readCache saved in path, nil if it cannot be read.
+func readCache(path string) *analysisCache {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var saved analysisCache
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil
+	}
+	return &saved
+}
+
+// loadCache from path, starting from scratch if it cannot be read. Track results saved by another version are
+// discarded, but MusicBrainz lookups do not depend on the version and are kept.
+func loadCache(path, version string) *analysisCache {
+	c := &analysisCache{path: path, Version: version, Tracks: make(map[string]*cachedTrack)}
+	saved := readCache(path)
+	if saved == nil {
+		return c
+	}
+	c.MusicBrainz = saved.MusicBrainz
+	if saved.Version == version && saved.Tracks != nil {
+		c.Tracks = saved.Tracks
+	}
+	return c
+}
+
+// cacheKey identifies a track by its size, modification time and STREAMINFO MD5, but not its name.
+func cacheKey(f *flac.Flac) string {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d-%s", info.Size(), info.ModTime().UnixNano(), f.MD5)
+}
+
+// get a copy of what was cached for a track, nil if nothing was.
+func (c *analysisCache) get(f *flac.Flac) *cachedTrack {
+	if c == nil {
+		return nil
+	}
+	key := cacheKey(f)
+	c.Lock()
+	defer c.Unlock()
+	t, ok := c.Tracks[key]
+	if !ok || key == "" {
+		return nil
+	}
+	t.LastUsed = time.Now().Unix()
+	cached := *t
+	return &cached
+}
+
+// update what is cached for a track.
+func (c *analysisCache) update(f *flac.Flac, edit func(t *cachedTrack)) {
+	if c == nil {
+		return
+	}
+	key := cacheKey(f)
+	if key == "" {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	t, ok := c.Tracks[key]
+	if !ok {
+		t = &cachedTrack{}
+		c.Tracks[key] = t
+	}
+	t.LastUsed = time.Now().Unix()
+	edit(t)
+	if c.updated == nil {
+		c.updated = make(map[string]bool)
+	}
+	c.updated[key] = true
+}
+
+// lockCache so that only one run saves it at a time. It returns a function to unlock it.
+func lockCache(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(cacheLockTimeout)
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			lock.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > cacheLockTimeout {
+			// left by a crashed run
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("could not lock " + path)
+		}
+		time.Sleep(cacheLockRetry)
+	}
+}
+
+// merge what other runs saved since the cache was loaded, except for the tracks updated by this run.
+func (c *analysisCache) merge(saved *analysisCache) {
+	if saved.Version == c.Version {
+		for key, t := range saved.Tracks {
+			if c.updated[key] {
+				continue
+			}
+			if current, ok := c.Tracks[key]; ok && current.LastUsed > t.LastUsed {
+				t.LastUsed = current.LastUsed
+			}
+			c.Tracks[key] = t
+		}
+	}
+	for id, data := range saved.MusicBrainz {
+		if _, ok := c.MusicBrainz[id]; !ok {
+			if c.MusicBrainz == nil {
+				c.MusicBrainz = make(map[string]json.RawMessage)
+			}
+			c.MusicBrainz[id] = data
+		}
+	}
+}
+
+// prune entries for tracks that were not analysed for a long time.
+func (c *analysisCache) prune() {
+	limit := time.Now().Add(-cacheMaxAge).Unix()
+	for key, t := range c.Tracks {
+		switch {
+		case t.LastUsed == 0:
+			// saved before the last use was tracked
+			t.LastUsed = time.Now().Unix()
+		case t.LastUsed < limit:
+			delete(c.Tracks, key)
+		}
+	}
+}
+
+// save the cache as JSON, merged with what other runs saved in the meantime. It is written to a temporary file first
+// so that it is never read half-written.
+func (c *analysisCache) save() error {
+	if c == nil {
+		return nil
+	}
+	dir := filepath.Dir(c.path)
+	if !fs.DirExists(dir) {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	unlock, err := lockCache(c.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c.Lock()
+	defer c.Unlock()
+	if saved := readCache(c.path); saved != nil {
+		c.merge(saved)
+	}
+	c.prune()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, cacheFile+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// getMusicBrainz release lookup, nil if it was not cached.
+func (c *analysisCache) getMusicBrainz(id string) []byte {
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.MusicBrainz[id]
+}
+
+// setMusicBrainz release lookup.
+func (c *analysisCache) setMusicBrainz(id string, data []byte) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.MusicBrainz == nil {
+		c.MusicBrainz = make(map[string]json.RawMessage)
+	}
+	c.MusicBrainz[id] = data
+}
@@ -0,0 +1,119 @@
+package propolis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/music"
+)
+
+func TestCacheSave(t *testing.T) {
+	fmt.Println("+ Testing analysisCache...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metadata", cacheFile)
+	var tracks []*flac.Flac
+	for i := 0; i < 4; i++ {
+		tracks = append(tracks, writeTestFlac(t, filepath.Join(dir, "release", fmt.Sprintf("%02d.flac", i+1)), 2, testBlockSize*(i+1), noise))
+	}
+
+	// concurrent runs analysing different tracks keep each other's results
+	var wg sync.WaitGroup
+	for i := range tracks {
+		wg.Add(1)
+		go func(f *flac.Flac, bitDepth int) {
+			defer wg.Done()
+			c := loadCache(path, "v1")
+			c.update(f, func(t *cachedTrack) {
+				t.PaddedBitsChecked = true
+				t.TrueBitDepth = bitDepth
+			})
+			check.Nil(c.save())
+		}(tracks[i], i+1)
+	}
+	wg.Wait()
+	check.NoFileExists(path + ".lock")
+	c := loadCache(path, "v1")
+	check.Equal(len(tracks), len(c.Tracks))
+	for i, f := range tracks {
+		cached := c.get(f)
+		if check.NotNil(cached) {
+			check.Equal(i+1, cached.TrueBitDepth)
+		}
+	}
+
+	// the most recent results are kept
+	other := loadCache(path, "v1")
+	c.update(tracks[0], func(t *cachedTrack) { t.TrueBitDepth = 24 })
+	check.Nil(c.save())
+	check.Nil(other.save())
+	check.Equal(24, loadCache(path, "v1").get(tracks[0]).TrueBitDepth)
+
+	// old entries are pruned
+	c = loadCache(path, "v1")
+	c.Tracks[cacheKey(tracks[1])].LastUsed = time.Now().Add(-2 * cacheMaxAge).Unix()
+	c.prune()
+	check.Nil(c.get(tracks[1]))
+	check.NotNil(c.get(tracks[2]))
+
+	// track results are discarded by another version
+	c = loadCache(path, "v2")
+	check.Empty(c.Tracks)
+
+	// a lock left by a crashed run is ignored once it is old enough
+	unlock, err := lockCache(path)
+	check.Nil(err)
+	old := time.Now().Add(-2 * cacheLockTimeout)
+	check.Nil(os.Chtimes(path+".lock", old, old))
+	c.update(tracks[2], func(t *cachedTrack) { t.TrueBitDepth = 16 })
+	check.Nil(c.save())
+	unlock()
+	check.Equal(16, loadCache(path, "v2").get(tracks[2]).TrueBitDepth)
+}
+
+func TestCacheSpectrograms(t *testing.T) {
+	fmt.Println("+ Testing cached spectrograms...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "metadata", cacheFile)
+	root := filepath.Join(dir, "release")
+	track := writeTestFlac(t, filepath.Join(root, "01.flac"), 2, testBlockSize, noise)
+
+	release := music.NewWithExternalMetadata(root, filepath.Join(dir, "metadata", "first"))
+	release.Flacs = []*flac.Flac{track}
+	p := NewPropolis(root, release, false)
+	p.UseCache(cachePath, "v1")
+	full := spectrogramPath(release.MetadataPath, track.Path)
+	check.Nil(os.MkdirAll(release.MetadataPath, 0777))
+	check.Nil(ioutil.WriteFile(full, []byte("spectrogram"), 0600))
+	p.cacheSpectrograms()
+	check.Nil(p.SaveCache())
+	check.Equal(full, p.cache.get(track).Spectrogram)
+
+	// after the release is moved, the spectrogram is copied to the new metadata folder
+	release = music.NewWithExternalMetadata(root, filepath.Join(dir, "metadata", "second"))
+	release.Flacs = []*flac.Flac{track}
+	p = NewPropolis(root, release, false)
+	p.UseCache(cachePath, "v1")
+	p.restoreSpectrograms()
+	data, err := ioutil.ReadFile(spectrogramPath(release.MetadataPath, track.Path))
+	check.Nil(err)
+	check.Equal("spectrogram", string(data))
+
+	// spectrograms with another track name are not reused
+	check.Nil(os.Rename(track.Path, filepath.Join(root, "02.flac")))
+	renamed, err := flac.New(filepath.Join(root, "02.flac"))
+	check.Nil(err)
+	release.Flacs = []*flac.Flac{renamed}
+	p.restoreSpectrograms()
+	check.NoFileExists(spectrogramPath(release.MetadataPath, renamed.Path))
+}
@@ -0,0 +1,131 @@
+package propolis
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mewkiz/flac/frame"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	// channelMaskField is set by the flac encoder when the channel layout is not the default one for the channel count.
+	channelMaskField = "WAVEFORMATEXTENSIBLE_CHANNEL_MASK"
+	// maxChannelDifference between samples still considered identical (or opposite), allowing for dithering.
+	maxChannelDifference = 1
+	// identicalChannelsRatio is the proportion of non-silent samples that must be identical (or opposite) for the
+	// whole track to be considered mono (or inverted).
+	identicalChannelsRatio = 0.99
+)
+
+var (
+	// speakers, by bit of the WAVEFORMATEXTENSIBLE channel mask.
+	speakerPositions = []string{"FL", "FR", "FC", "LFE", "BL", "BR", "FLC", "FRC", "BC", "SL", "SR", "TC", "TFL", "TFC", "TFR", "TBL", "TBC", "TBR"}
+	// defaultChannelLayouts of FLAC files without a channel mask, by channel count.
+	defaultChannelLayouts = map[int]string{
+		1: "FC",
+		2: "FL FR",
+		3: "FL FR FC",
+		4: "FL FR BL BR",
+		5: "FL FR FC BL BR",
+		6: "FL FR FC LFE BL BR",
+		7: "FL FR FC LFE BC SL SR",
+		8: "FL FR FC LFE BL BR SL SR",
+	}
+)
+
+// channelStats compares the left and right channels of stereo tracks while decoding.
+type channelStats struct {
+	// samples where at least one channel is not silent
+	nonSilent uint64
+	identical uint64
+	inverted  uint64
+}
+
+func absInt32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// add the samples of a decoded stereo frame.
+func (s *channelStats) add(fr *frame.Frame) {
+	if len(fr.Subframes) != 2 {
+		return
+	}
+	left, right := fr.Subframes[0].Samples, fr.Subframes[1].Samples
+	for i := 0; i < int(fr.BlockSize); i++ {
+		if left[i] == 0 && right[i] == 0 {
+			continue
+		}
+		s.nonSilent++
+		if absInt32(left[i]-right[i]) <= maxChannelDifference {
+			s.identical++
+		}
+		if absInt32(left[i]+right[i]) <= maxChannelDifference {
+			s.inverted++
+		}
+	}
+}
+
+// mono if both channels are almost always the same.
+func (s channelStats) mono() bool {
+	return s.nonSilent != 0 && float64(s.identical)/float64(s.nonSilent) >= identicalChannelsRatio
+}
+
+// invertedPhase if one channel is almost always the opposite of the other, cancelling out when downmixed to mono.
+func (s channelStats) invertedPhase() bool {
+	return s.nonSilent != 0 && float64(s.inverted)/float64(s.nonSilent) >= identicalChannelsRatio
+}
+
+// channelLayout of a track, from its channel mask or the FLAC default for its channel count.
+func channelLayout(f *flac.Flac) string {
+	mask := rawTagValue(f, channelMaskField)
+	if mask == "" {
+		if layout, ok := defaultChannelLayouts[f.ChannelCount]; ok {
+			return layout
+		}
+		return "unknown layout"
+	}
+	value, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(mask), "0x"), 16, 32)
+	if err != nil {
+		return "invalid channel mask " + mask
+	}
+	var speakers []string
+	for i, s := range speakerPositions {
+		if value&(1<<uint(i)) != 0 {
+			speakers = append(speakers, s)
+		}
+	}
+	return fmt.Sprintf("%s (channel mask %s)", strings.Join(speakers, " "), mask)
+}
+
+// checkChannels checks the channel count is consistent, and looks for multichannel tracks and stereo tracks that are
+// really mono or have an inverted channel.
+func (p *Propolis) checkChannels(integrity []*trackIntegrity) {
+	var counts, multichannel, mono, inverted []string
+	for i, f := range p.release.Flacs {
+		name := filepath.Base(f.Path)
+		counts = append(counts, strconv.Itoa(f.ChannelCount))
+		if f.ChannelCount > 2 {
+			multichannel = append(multichannel, fmt.Sprintf("%s: %d channels, %s", name, f.ChannelCount, channelLayout(f)))
+		}
+		if f.ChannelCount == 2 && i < len(integrity) {
+			switch {
+			case integrity[i].channels.mono():
+				mono = append(mono, name)
+			case integrity[i].channels.invertedPhase():
+				inverted = append(inverted, name)
+			}
+		}
+	}
+	strslice.RemoveDuplicates(&counts)
+	p.ConditionCheck(LevelWarning, "2.1.6", fmt.Sprintf(OKSameChannelCount, counts[0]), fmt.Sprintf(KOSameChannelCount, strings.Join(counts, ", ")), len(counts) == 1)
+	p.ListCheck(LevelInfo, internalRule, OKMultichannel, KOMultichannel, multichannel)
+	p.ListCheck(LevelWarning, internalRule, OKMonoAsStereo, KOMonoAsStereo, mono)
+	p.ListCheck(LevelWarning, internalRule, OKInvertedPhase, KOInvertedPhase, inverted)
+}
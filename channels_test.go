@@ -0,0 +1,84 @@
+package propolis
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac/frame"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelLayout(t *testing.T) {
+	fmt.Println("+ Testing channelLayout...")
+	check := assert.New(t)
+
+	cases := []struct {
+		channels int
+		mask     string
+		expected string
+	}{
+		{1, "", "FC"},
+		{2, "", "FL FR"},
+		{6, "", "FL FR FC LFE BL BR"},
+		{8, "", "FL FR FC LFE BL BR SL SR"},
+		{6, "0x060F", "FL FR FC LFE SL SR (channel mask 0x060F)"},
+		{4, "0x33", "FL FR BL BR (channel mask 0x33)"},
+		{2, "0X3", "FL FR (channel mask 0X3)"},
+		{4, "0x0107", "FL FR FC BC (channel mask 0x0107)"},
+		{3, "surround", "invalid channel mask surround"},
+	}
+	dir := t.TempDir()
+	for i, c := range cases {
+		var tags []string
+		if c.mask != "" {
+			tags = append(tags, channelMaskField+"="+c.mask)
+		}
+		f := writeTestFlac(t, filepath.Join(dir, fmt.Sprintf("%02d.flac", i)), c.channels, testBlockSize, noise, tags...)
+		check.Equal(c.expected, channelLayout(f), fmt.Sprintf("%d channels, mask %q", c.channels, c.mask))
+	}
+}
+
+func TestChannelStats(t *testing.T) {
+	fmt.Println("+ Testing channelStats...")
+	check := assert.New(t)
+
+	stereoFrame := func(right func(left int32) int32) *frame.Frame {
+		fr := &frame.Frame{Header: frame.Header{BlockSize: 1000}, Subframes: []*frame.Subframe{{}, {}}}
+		for i := 0; i < int(fr.BlockSize); i++ {
+			left := noise(0, i)
+			if i < 100 {
+				// silence is ignored
+				left = 0
+			}
+			fr.Subframes[0].Samples = append(fr.Subframes[0].Samples, left)
+			fr.Subframes[1].Samples = append(fr.Subframes[1].Samples, right(left))
+		}
+		return fr
+	}
+	cases := []struct {
+		name     string
+		right    func(left int32) int32
+		mono     bool
+		inverted bool
+	}{
+		{"stereo", func(left int32) int32 { return left / 2 }, false, false},
+		{"mono", func(left int32) int32 { return left }, true, false},
+		{"dithered mono", func(left int32) int32 { return left + left%2 }, true, false},
+		{"inverted", func(left int32) int32 { return -left }, false, true},
+	}
+	for _, c := range cases {
+		var stats channelStats
+		stats.add(stereoFrame(c.right))
+		check.Equal(c.mono, stats.mono(), c.name)
+		check.Equal(c.inverted, stats.invertedPhase(), c.name)
+	}
+
+	// silent tracks are neither mono nor inverted, and only stereo frames are compared
+	var stats channelStats
+	stats.add(&frame.Frame{Header: frame.Header{BlockSize: 2}, Subframes: []*frame.Subframe{{Samples: []int32{0, 0}}, {Samples: []int32{0, 0}}}})
+	stats.add(&frame.Frame{Header: frame.Header{BlockSize: 2}, Subframes: []*frame.Subframe{{Samples: []int32{1, 2}}}})
+	check.Equal(uint64(0), stats.nonSilent)
+	check.False(stats.mono())
+	check.False(stats.invertedPhase())
+}
@@ -22,6 +22,7 @@ const (
 )
 
 type Check struct {
+	ID            string `json:"id"`
 	Rule          string `json:"rule"`
 	ConditionOK   string `json:"-"`
 	ConditionKO   string `json:"-"`
@@ -16,6 +16,12 @@ import (
 
 func (p *Propolis) CheckRelease() {
 	totalSize := float64(fs.GetTotalSize(p.release.Path)) / (1024 * 1024)
+	// MP3 releases, with no FLACs at all, have their own checks
+	if mp3s := fs.GetAllowedFilesByExt(p.release.Path, []string{mp3Ext}); len(mp3s) != 0 && len(music.GetAllFLACs(p.release.Path)) == 0 {
+		p.CheckMP3Release(mp3s)
+		p.ConditionCheck(LevelInfo, internalRule, fmt.Sprintf(OKTotalSize, strconv.FormatFloat(totalSize, 'f', 2, 32)), BlankBecauseImpossible, true)
+		return
+	}
 	err := p.release.ParseFiles()
 	p.ErrorCheck(LevelCritical, "2.3.1", OKReleaseHasFlacs, KOReleaseHasFlacs, err, DoNotAppendError)
 	if err != nil {
@@ -42,7 +48,14 @@ func (p *Propolis) CheckMusicFiles() {
 	}
 	// checking for consistency in sample rate
 	isConsistent, sampleRate := p.release.CheckConsistentSampleRate()
-	p.ConditionCheck(LevelWarning, "2.1.6", fmt.Sprintf(OKSameSampleRate, sampleRate), KOSameSampleRate, isConsistent)
+	switch source := p.source(); source {
+	case sourceWEB:
+		p.ConditionCheck(LevelWarning, "2.1.6.2", fmt.Sprintf(OKSameSampleRate, sampleRate), KOSameSampleRateWEB, isConsistent)
+	case sourceUnknown:
+		p.ConditionCheck(LevelWarning, "2.1.6", fmt.Sprintf(OKSameSampleRate, sampleRate), KOSameSampleRate, isConsistent)
+	default:
+		p.ConditionCheck(LevelCritical, "2.1.6", fmt.Sprintf(OKSameSampleRate, sampleRate), fmt.Sprintf(KOSameSampleRateSource, source), isConsistent)
+	}
 	sr, _ := strconv.Atoi(sampleRate)
 	p.ConditionCheck(LevelCritical, "2.1.1", ArrowHeader+OKValidSampleRate, ArrowHeader+KOValidSampleRate, sr <= 192000)
 	// NOTE: is the rule track-by-track or on average in the release? what about the stupid "silent" tracks in some releases before a hidden song?
@@ -51,41 +64,73 @@ func (p *Propolis) CheckMusicFiles() {
 	// checking if mutt rip
 	forbidden := fs.GetAllowedFilesByExt(p.release.Path, nonFlacMusicExtensions)
 	p.ConditionCheck(LevelCritical, "2.1.6.3", OKMuttRip, fmt.Sprintf(KOMuttRip, strings.Join(forbidden, ",")), len(forbidden) == 0)
-	// checking flac integrity
-	err := p.release.Check()
-	p.ErrorCheck(LevelCritical, "2.2.10.8", integrityCheckOK, KOIntegrityCheck, err, DoNotAppendError)
-	if err != nil {
-		if errors.Is(err, flac.ErrNoFlacHeader) {
-			p.ErrorCheck(LevelCritical, "2.2.10.8", "", ArrowHeader+KOID3Tags, err, AppendError)
-		} else {
-			p.ErrorCheck(LevelCritical, internalRule, "", ArrowHeader+KOIntegrity, err, AppendError)
+	// checking flac integrity, track by track
+	var integrityProblems, unsetMD5 []string
+	var id3Err error
+	integrity := checkIntegrity(p.release.Flacs, p.jobs, p.cache)
+	for _, t := range integrity {
+		integrityProblems = append(integrityProblems, t.Problems()...)
+		if t.md5Unset {
+			unsetMD5 = append(unsetMD5, t.track)
+		}
+		if errors.Is(t.flacErr, flac.ErrNoFlacHeader) {
+			id3Err = t.flacErr
 		}
 	}
+	p.ListCheck(LevelCritical, "2.2.10.8", integrityCheckOK, KOIntegrityCheck, integrityProblems)
+	if id3Err != nil {
+		p.ErrorCheck(LevelCritical, "2.2.10.8", "", ArrowHeader+KOID3Tags, id3Err, AppendError)
+	}
+	p.ListCheck(LevelCritical, internalRule, OKMD5Set, KOMD5Set, unsetMD5)
+	// checking channels, using what was decoded
+	p.checkChannels(integrity)
 	// checking for id3v1 tags
-	err = p.release.CheckForID3v1Tags()
+	err := p.release.CheckForID3v1Tags()
 	p.ErrorCheck(LevelWarning, internalRule, OKID3v1Tags, KOID3v1Tags, err, DoNotAppendError)
-	// checking for uncompressed flacs
-	err = p.release.CheckCompression()
-	p.ErrorCheck(LevelCritical, "2.2.10.10", OKUncompressedFlac, KOUncompressedFlac, err, DoNotAppendError)
-	if err != nil {
-		if errors.Is(err, flac.ErrorUncompressed) {
-			p.ErrorCheck(LevelCritical, "2.2.10.10", BlankBecauseImpossible, ArrowHeader+KOUncompressed, err, AppendError)
-		} else {
-			p.ErrorCheck(LevelCritical, "2.2.10.10", BlankBecauseImpossible, ArrowHeader+OtherError, err, AppendError)
+	// checking for uncompressed flacs, from the decoded subframes of every track
+	var uncompressed []string
+	for _, t := range integrity {
+		if err := t.CheckCompression(); err != nil {
+			uncompressed = append(uncompressed, err.Error())
 		}
 	}
+	p.ListCheck(LevelCritical, "2.2.10.10", OKUncompressedFlac, KOUncompressedFlac, uncompressed)
 
 	if len(p.release.Flacs) != 0 {
 		// checking for MQA encoding
 		p.ConditionCheck(LevelCritical, "upload#DNU", OKNoMQAMetadata, KONoMQAMetadata, !p.release.Flacs[0].CheckForMQAMetadata())
-		isMQA, _, _ := p.release.Flacs[0].CheckForMQASyncword()
+		isMQA := p.checkForMQASyncword(p.release.Flacs[0])
 		p.ConditionCheck(LevelCritical, "upload#DNU", OKNoMQASyncword, KONoMQASyncword, !isMQA)
 		// checking for padded bits
-		isPadded, trueBitDepth, _ := p.release.Flacs[0].CheckForPaddedBits()
+		isPadded, trueBitDepth := p.checkForPaddedBits(p.release.Flacs[0])
 		p.ConditionCheck(LevelWarning, internalRule, OKNoPaddedBits, fmt.Sprintf(KOPaddedBits, trueBitDepth), !isPadded)
 	}
 }
 
+// checkForMQASyncword in a track, unless the result was cached.
+func (p *Propolis) checkForMQASyncword(f *flac.Flac) bool {
+	if cached := p.cache.get(f); cached != nil && cached.MQAChecked {
+		return cached.MQASyncword
+	}
+	isMQA, _, _ := f.CheckForMQASyncword()
+	p.cache.update(f, func(t *cachedTrack) {
+		t.MQAChecked, t.MQASyncword = true, isMQA
+	})
+	return isMQA
+}
+
+// checkForPaddedBits in a track, unless the result was cached.
+func (p *Propolis) checkForPaddedBits(f *flac.Flac) (bool, int) {
+	if cached := p.cache.get(f); cached != nil && cached.PaddedBitsChecked {
+		return cached.PaddedBits, cached.TrueBitDepth
+	}
+	isPadded, trueBitDepth, _ := f.CheckForPaddedBits()
+	p.cache.update(f, func(t *cachedTrack) {
+		t.PaddedBitsChecked, t.PaddedBits, t.TrueBitDepth = true, isPadded, trueBitDepth
+	})
+	return isPadded, trueBitDepth
+}
+
 func (p *Propolis) CheckOrganization(snatched bool) {
 	// checking for overly long paths
 	longFiles := fs.GetExceedinglyLongPaths(p.release.Path, 180)
@@ -118,6 +163,10 @@ func (p *Propolis) CheckOrganization(snatched bool) {
 	// checking for empty dirs or uselessly nested folders
 	p.ConditionCheck(LevelCritical, "2.3.3", OKEmptyFolders, KOEmptyFolders, !fs.HasEmptyNestedFolders(p.release.Path))
 	p.ConditionCheck(LevelCritical, "2.3.20", OKNoLeadingDot, KONoLeadingDot, len(fs.GetFilesAndFoldersByPrefix(p.release.Path, forbiddenLeadingCharacters)) == 0)
+	if len(p.mp3s) != 0 {
+		p.checkMP3MultiDiscOrganization()
+		return
+	}
 	err := p.release.CheckMultiDiscOrganization()
 	p.ErrorCheck(LevelCritical, "2.3.15", OKMultiDiscOrganization, KOMultiDiscOrganization, err, AppendError)
 }
@@ -147,6 +196,66 @@ func (p *Propolis) CheckTags() {
 	p.ErrorCheck(LevelCritical, "2.1.19", OKNotMissingFiles, KOMissingFiles, p.release.CheckForMissingTracks(), AppendError)
 }
 
+func (p *Propolis) CheckTagHygiene() {
+	if p.isEnabled(CheckTagWhitespace) {
+		p.ListCheck(LevelWarning, internalRule, OKTagWhitespace, KOTagWhitespace, findTagsWithExtraWhitespace(p.release.Flacs))
+	}
+	if p.isEnabled(CheckTagDuplicates) {
+		p.ListCheck(LevelWarning, internalRule, OKTagDuplicates, KOTagDuplicates, findDuplicateTags(p.release.Flacs))
+	}
+	if p.isEnabled(CheckTagEmpty) {
+		p.ListCheck(LevelWarning, internalRule, OKTagEmpty, KOTagEmpty, findEmptyTags(p.release.Flacs))
+	}
+	if p.isEnabled(CheckTagFieldNames) {
+		p.ListCheck(LevelWarning, internalRule, OKTagFieldNames, KOTagFieldNames, findNonCanonicalFieldNames(p.release.Flacs))
+	}
+	if p.isEnabled(CheckTagControlCharacters) {
+		p.ListCheck(LevelCritical, internalRule, OKTagControlCharacters, KOTagControlCharacters, findTagsWithControlCharacters(p.release.Flacs))
+	}
+	if p.isEnabled(CheckTagMojibake) {
+		p.ListCheck(LevelCritical, internalRule, OKTagMojibake, KOTagMojibake, findMojibakeTags(p.release.Flacs))
+	}
+	if p.isEnabled(CheckTagCruft) {
+		p.ListCheck(LevelWarning, internalRule, OKTagCruft, KOTagCruft, findTaggerCruft(p.release.Flacs))
+	}
+}
+
+func (p *Propolis) CheckArtwork() {
+	artwork, err := p.embeddedArtwork()
+	if err != nil {
+		p.ErrorCheck(LevelWarning, internalRule, BlankBecauseImpossible, KOArtworkParsing, err, AppendError)
+		return
+	}
+	if len(artwork) == 0 {
+		p.ConditionCheck(LevelInfo, internalRule, OKNoArtwork, BlankBecauseImpossible, true)
+		return
+	}
+	if p.isEnabled(CheckArtworkFrontCover) {
+		p.ListCheck(LevelWarning, internalRule, OKArtworkFrontCover, KOArtworkFrontCover, findTracksWithoutFrontCover(artwork))
+	}
+	if p.isEnabled(CheckArtworkMIME) {
+		p.ListCheck(LevelWarning, internalRule, OKArtworkMIME, KOArtworkMIME, findArtworkMIMEMismatches(artwork))
+	}
+	if p.isEnabled(CheckArtworkDimensions) {
+		p.ListCheck(LevelWarning, internalRule, OKArtworkDimensions, KOArtworkDimensions, findArtworkDimensionProblems(artwork))
+	}
+	if p.isEnabled(CheckArtworkCorrupt) {
+		p.ListCheck(LevelCritical, internalRule, OKArtworkCorrupt, KOArtworkCorrupt, findCorruptArtwork(artwork))
+	}
+	if p.isEnabled(CheckArtworkConsistency) {
+		p.ListCheck(LevelWarning, internalRule, OKArtworkConsistency, KOArtworkConsistency, findDifferentFrontCovers(artwork))
+	}
+	// comparing with the folder cover
+	largest := largestFrontCover(artwork)
+	cover := filepath.Join(p.release.Path, music.DefaultCover)
+	if p.isEnabled(CheckArtworkVsCover) && largest != nil && fs.FileExists(cover) {
+		width, height, err := getImageSize(cover)
+		if err == nil {
+			p.ConditionCheck(LevelInfo, internalRule, fmt.Sprintf(OKArtworkVsCover, music.DefaultCover), fmt.Sprintf(KOArtworkVsCover, largest.width, largest.height, music.DefaultCover, width, height), width*height >= largest.width*largest.height)
+		}
+	}
+}
+
 func (p *Propolis) CheckFilenames(snatched bool) {
 	// checking for forbidden characters
 	withForbiddenChars := fs.GetFilesAndFoldersBySubstring(p.release.Path, forbiddenCharacters)
@@ -157,6 +266,10 @@ func (p *Propolis) CheckFilenames(snatched bool) {
 	if len(withForbiddenChars) != 0 {
 		p.ConditionCheck(LevelCritical, internalRule, BlankBecauseImpossible, ArrowHeader+fmt.Sprintf(InvalidCharacters, strings.Join(withForbiddenChars, ", ")), len(withForbiddenChars) == 0)
 	}
+	if len(p.mp3s) != 0 {
+		p.checkMP3Filenames()
+		return
+	}
 	// detecting track.FLAC, track.Flac
 	var capitalizedExt bool
 	for _, f := range p.release.Flacs {
@@ -167,6 +280,12 @@ func (p *Propolis) CheckFilenames(snatched bool) {
 	}
 	p.ConditionCheck(LevelWarning, internalRule, OKLowerCaseExtensions, KOLowerCaseExtensions, !capitalizedExt)
 	// checking filenames contain track numbers and (at least part of) the title
+	if p.source() == sourceVinyl && p.sideNumbered() {
+		// track numbers are not numbers, filenames cannot be compared with them
+		p.ConditionCheck(LevelInfo, "2.3.13", OKVinylSideNumbers, BlankBecauseImpossible, true)
+		p.ConditionCheck(LevelCritical, "2.3.11", OKTitleInFilenames, KOTitleInFilenames, p.release.CheckFilenameContainsStartOfTitle(minTitleSize))
+		return
+	}
 	if len(p.release.Flacs) != 1 {
 		p.ConditionCheck(LevelCritical, "2.3.13", OKTrackNumbersInFilenames, KOTrackNumbersInFilenames, p.release.CheckTrackNumbersInFilenames())
 	} else {
@@ -183,27 +302,42 @@ func (p *Propolis) CheckFilenames(snatched bool) {
 }
 
 func (p *Propolis) CheckFolderName() {
+	if len(p.mp3s) != 0 {
+		p.checkMP3FolderName()
+		return
+	}
 	if len(p.release.Flacs) == 0 {
 		p.ConditionCheck(LevelCritical, internalRule, BlankBecauseImpossible, KOFlacPresent, len(p.release.Flacs) != 0)
 		return
 	}
-	// comparisons are case insensitive
-	folderName := strings.ToLower(filepath.Base(p.release.Path))
 	// getting metadata
 	tags := p.release.Flacs[0].CommonTags()
-	title := tags.Album
-
-	// checking title is in folder name
-	p.ConditionCheck(LevelCritical, "2.3.2", OKTitleInFoldername, KOTitleInFoldername, flac.StringContainsStartOfAnother(folderName, title, 30))
-	// checking artists are in the folder name
 	artists := tags.AlbumArtist
 	if len(artists) == 0 {
 		// no album artist found, falling back to artists
 		for _, f := range p.release.Flacs {
 			artists = append(artists, f.CommonTags().Artist...)
 		}
-		strslice.RemoveDuplicates(&artists)
 	}
+	folderName := p.checkFolderNameTags(tags.Album, artists, tags.Year, tags.Date)
+	// checking if formal is mentioned
+	p.ConditionCheck(LevelWarning, "2.3.2", OKFormatInFoldername, KOFormatInFoldername, strings.Contains(folderName, "flac"))
+	if p.release.Has24bitTracks() {
+		p.ConditionCheck(LevelWarning, "2.3.2", OK24BitInFoldername, KO24BitInFoldername, strings.Contains(folderName, "24"))
+	}
+	p.checkFolderNameSource(folderName)
+}
+
+// checkFolderNameTags checks the title, artists and year are in the folder name, and returns the folder name in lower
+// case.
+func (p *Propolis) checkFolderNameTags(title string, artists []string, year, date string) string {
+	// comparisons are case insensitive
+	folderName := strings.ToLower(filepath.Base(p.release.Path))
+
+	// checking title is in folder name
+	p.ConditionCheck(LevelCritical, "2.3.2", OKTitleInFoldername, KOTitleInFoldername, flac.StringContainsStartOfAnother(folderName, title, 30))
+	// checking artists are in the folder name
+	strslice.RemoveDuplicates(&artists)
 	// if more than 3 artists, release should be VA
 	if len(artists) >= 3 {
 		artists = []string{"Various Artists", "VA"}
@@ -220,8 +354,6 @@ func (p *Propolis) CheckFolderName() {
 	}
 	p.ConditionCheck(LevelWarning, "2.3.2", OKArtistsInFoldername, fmt.Sprintf(KOArtistsInFoldername, strings.Join(artistsNotFound, ", ")), len(artistsNotFound) == 0)
 	// checking year is mentioned
-	year := tags.Year
-	date := tags.Date
 	if year != "" || date != "" {
 		var foundYear, foundDate bool
 		if year != "" {
@@ -232,29 +364,29 @@ func (p *Propolis) CheckFolderName() {
 		}
 		p.ConditionCheck(LevelWarning, "2.3.2", OKYearInFoldername, KOYearInFoldername, foundYear || foundDate)
 	}
-	// checking if formal is mentioned
-	p.ConditionCheck(LevelWarning, "2.3.2", OKFormatInFoldername, KOFormatInFoldername, strings.Contains(folderName, "flac"))
-	if p.release.Has24bitTracks() {
-		p.ConditionCheck(LevelWarning, "2.3.2", OK24BitInFoldername, KO24BitInFoldername, strings.Contains(folderName, "24"))
-	}
-	// checking if source is mentioned
-	logsAndCues := fs.GetAllowedFilesByExt(p.release.Path, []string{".log", ".cue"})
-	var cleanLogsAndCues []string
-	for _, f := range logsAndCues {
-		if !strings.Contains(f, "propolis") {
-			cleanLogsAndCues = append(cleanLogsAndCues, f)
-		}
-	}
-	if len(cleanLogsAndCues) != 0 {
-		p.ConditionCheck(LevelWarning, "2.3.2", OKCDInFoldername, KOCDInFoldername, strings.Contains(folderName, "cd"))
-	} else {
+	return folderName
+}
+
+// checkFolderNameSource checks the folder name mentions the source.
+func (p *Propolis) checkFolderNameSource(folderName string) {
+	switch source := p.source(); source {
+	case sourceUnknown:
 		p.ConditionCheck(LevelWarning, "2.3.2", OKWEBInFoldername, KOWEBInFoldername, strings.Contains(folderName, "web") || strings.Contains(folderName, "vinyl"))
+	case sourceCD:
+		p.ConditionCheck(LevelWarning, "2.3.2", OKCDInFoldername, KOCDInFoldername, strings.Contains(folderName, "cd"))
+	default:
+		p.ConditionCheck(LevelWarning, "2.3.2", fmt.Sprintf(OKSourceInFoldername, source), fmt.Sprintf(KOSourceInFoldername, source), strings.Contains(folderName, strings.ToLower(source)))
 	}
 }
 
 func (p *Propolis) CheckExtraFiles() {
-	// checking for cover
-	p.ConditionCheck(LevelWarning, internalRule, fmt.Sprintf(OKCoverFound, music.DefaultCover), fmt.Sprintf(KOCoverFound, music.DefaultCover), p.release.HasCover())
+	// checking for cover, only in the top folder for MP3 releases
+	hasCover := p.release.HasCover()
+	if len(p.mp3s) != 0 {
+		hasCover = fs.FileExists(filepath.Join(p.release.Path, music.DefaultCover))
+	}
+	p.ConditionCheck(LevelWarning, internalRule, fmt.Sprintf(OKCoverFound, music.DefaultCover), fmt.Sprintf(KOCoverFound, music.DefaultCover), hasCover)
+	p.CheckCoverQuality()
 	// checking for extra files
 	nonMusic := fs.GetAllowedFilesByExt(p.release.Path, nonMusicExtensions)
 	p.ConditionCheck(LevelWarning, internalRule, fmt.Sprintf(OKExtraFiles, len(nonMusic)), KOExtraFiles, len(nonMusic) != 0)
@@ -266,14 +398,172 @@ func (p *Propolis) CheckExtraFiles() {
 	p.ConditionCheck(LevelWarning, internalRule, fmt.Sprintf(OKExtraFilesRatio, strconv.FormatFloat(ratio, 'f', 2, 32)), fmt.Sprintf(KOExtraFilesRatio, strconv.FormatFloat(ratio, 'f', 2, 32)), ratio < 10)
 }
 
-func GenerateSpectrograms(release *music.Release, generateCombined, verbose bool) (string, error) {
-	// generating full spectrograms
-	_, err := release.GenerateSpectrograms("propolis", verbose)
+func (p *Propolis) CheckCoverQuality() {
+	covers, err := getFolderCovers(p.release.Path)
+	if err != nil {
+		p.ErrorCheck(LevelWarning, internalRule, BlankBecauseImpossible, KOCoverParsing, err, AppendError)
+		return
+	}
+	if len(covers) == 0 {
+		return
+	}
+	if p.isEnabled(CheckCoverResolution) {
+		p.ListCheck(LevelWarning, internalRule, OKCoverResolution, KOCoverResolution, findCoverResolutionProblems(covers))
+	}
+	if p.isEnabled(CheckCoverAspectRatio) {
+		p.ListCheck(LevelWarning, internalRule, OKCoverAspectRatio, KOCoverAspectRatio, findCoverAspectRatioProblems(covers))
+	}
+	if p.isEnabled(CheckCoverFormat) {
+		p.ListCheck(LevelWarning, internalRule, OKCoverFormat, KOCoverFormat, findCoverFormatProblems(covers))
+	}
+	if p.isEnabled(CheckCoverTruncated) {
+		p.ListCheck(LevelCritical, internalRule, OKCoverTruncated, KOCoverTruncated, findTruncatedCovers(covers))
+	}
+	if p.isEnabled(CheckCoverMatchesArtwork) {
+		artwork, err := p.embeddedArtwork()
+		if err != nil {
+			return
+		}
+		if largest := largestFrontCover(artwork); largest != nil {
+			p.ListCheck(LevelWarning, internalRule, OKCoverMatchesArtwork, KOCoverMatchesArtwork, findCoversNotMatchingArtwork(covers, largest))
+		}
+	}
+}
+
+func (p *Propolis) CheckChecksumFiles(snatched bool) {
+	checksumFiles := fs.GetAllowedFilesByExt(p.release.Path, checksumExtensions)
+	accurip := fs.GetAllowedFilesByExt(p.release.Path, []string{accuripExt})
+	if snatched {
+		checksumFiles = IgnoreVarroaFiles(checksumFiles)
+	}
+	if len(accurip) != 0 {
+		p.ConditionCheck(LevelInfo, internalRule, fmt.Sprintf(OKAccurateRipFiles, len(accurip)), BlankBecauseImpossible, true)
+	}
+	if len(checksumFiles) == 0 {
+		p.ConditionCheck(LevelInfo, internalRule, OKNoChecksumFiles, BlankBecauseImpossible, true)
+		return
+	}
+	var mismatches, stale, empty []string
+	for _, path := range checksumFiles {
+		rel, _ := filepath.Rel(p.release.Path, path)
+		c, err := parseChecksumFile(path)
+		if err != nil {
+			p.ErrorCheck(LevelWarning, internalRule, BlankBecauseImpossible, fmt.Sprintf(KOChecksumFileParsing, rel), err, AppendError)
+			continue
+		}
+		if len(c.entries) == 0 {
+			empty = append(empty, rel)
+			continue
+		}
+		m, s := c.Verify(p.release.Path)
+		mismatches = append(mismatches, m...)
+		stale = append(stale, s...)
+	}
+	p.ListCheck(LevelCritical, internalRule, fmt.Sprintf(OKChecksumsMatch, len(checksumFiles)), KOChecksumsMatch, mismatches)
+	p.ListCheck(LevelWarning, internalRule, OKChecksumsStale, KOChecksumsStale, stale)
+	p.ListCheck(LevelWarning, internalRule, OKChecksumsEmpty, KOChecksumsEmpty, empty)
+}
+
+// CheckTrackerMetadata compares the tracker listing saved by varroa with the release, in snatched mode.
+func (p *Propolis) CheckTrackerMetadata() {
+	release, path, err := readTrackerMetadata(p.release.Path)
+	if err != nil {
+		p.ErrorCheck(LevelInfo, internalRule, BlankBecauseImpossible, KOTrackerMetadataFound, err, AppendError)
+		return
+	}
+	p.ConditionCheck(LevelInfo, internalRule, fmt.Sprintf(OKTrackerMetadataFound, filepath.Base(path)), BlankBecauseImpossible, true)
+
+	// format and encoding
+	p.ConditionCheck(LevelCritical, internalRule, OKTrackerFormat, fmt.Sprintf(KOTrackerFormat, release.Torrent.Format), release.Torrent.Format == "FLAC")
+	expectedEncoding := encodingLossless
+	if p.release.Has24bitTracks() {
+		expectedEncoding = encoding24bitLossless
+	}
+	p.ConditionCheck(LevelCritical, internalRule, fmt.Sprintf(OKTrackerEncoding, release.Torrent.Encoding), fmt.Sprintf(KOTrackerEncoding, release.Torrent.Encoding, expectedEncoding), release.Torrent.Encoding == expectedEncoding)
+
+	// media, only CD releases have logs and cues
+	rips := ripFiles(p.release.Path)
+	if release.Torrent.Media == sourceCD {
+		p.ConditionCheck(LevelWarning, internalRule, OKTrackerMediaCD, KOTrackerMediaCD, !release.Torrent.HasLog && !release.Torrent.HasCue || len(rips) != 0)
+	} else {
+		p.ConditionCheck(LevelWarning, internalRule, fmt.Sprintf(OKTrackerMedia, release.Torrent.Media), fmt.Sprintf(KOTrackerMedia, release.Torrent.Media), len(rips) == 0)
+	}
+
+	// tags
+	tags := p.release.Flacs[0].CommonTags()
+	p.ConditionCheck(LevelWarning, internalRule, OKTrackerAlbum, fmt.Sprintf(KOTrackerAlbum, release.title(), tags.Album), sameTitle(release.title(), tags.Album))
+	var tagArtists []string
+	for _, f := range p.release.Flacs {
+		t := f.CommonTags()
+		tagArtists = append(tagArtists, t.Artist...)
+		tagArtists = append(tagArtists, t.AlbumArtist...)
+	}
+	var artistsNotFound []string
+	for _, a := range release.artists() {
+		found := false
+		for _, t := range tagArtists {
+			if strings.Contains(strings.ToLower(t), strings.ToLower(a)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			artistsNotFound = append(artistsNotFound, a)
+		}
+	}
+	p.ListCheck(LevelWarning, internalRule, OKTrackerArtists, KOTrackerArtists, artistsNotFound)
+	year := release.Torrent.RemasterYear
+	if year == 0 {
+		year = release.Group.Year
+	}
+	if year != 0 {
+		y := strconv.Itoa(year)
+		p.ConditionCheck(LevelWarning, internalRule, OKTrackerYear, fmt.Sprintf(KOTrackerYear, y), strings.Contains(tags.Year, y) || strings.Contains(tags.Date, y))
+	}
+
+	// log score, as approximated by propolis
+	if release.Torrent.HasLog {
+		p.ListCheck(LevelInfo, internalRule, fmt.Sprintf(OKTrackerLogScore, release.Torrent.LogScore), fmt.Sprintf(KOTrackerLogScore, release.Torrent.LogScore, logScoreTolerance), trackerLogScoreProblems(rips, release.Torrent.LogScore))
+	}
+}
+
+// CheckTorrent compares the release with the .torrent it was downloaded with, given or found in varroa's metadata.
+func (p *Propolis) CheckTorrent(torrentPath, metadataDir string, snatched bool) {
+	if torrentPath == "" {
+		torrentPath = findTrackerTorrent(p.release.Path)
+		if torrentPath == "" {
+			p.ConditionCheck(LevelInfo, internalRule, BlankBecauseImpossible, KONoTorrentFound, false)
+			return
+		}
+	}
+	t, err := readTorrent(torrentPath)
+	p.ErrorCheck(LevelCritical, internalRule, fmt.Sprintf(OKTorrentFound, filepath.Base(torrentPath)), KOTorrentFound, err, AppendError)
+	if err != nil {
+		return
+	}
+	missing, extra, corrupted, err := compareWithTorrent(p.release.Path, metadataDir, snatched, t)
+	if err != nil {
+		p.ErrorCheck(LevelCritical, internalRule, BlankBecauseImpossible, KOTorrentCorrupted, err, AppendError)
+		return
+	}
+	p.ListCheck(LevelCritical, internalRule, OKTorrentMissing, KOTorrentMissing, missing)
+	p.ListCheck(LevelWarning, internalRule, OKTorrentExtra, KOTorrentExtra, extra)
+	p.ListCheck(LevelCritical, internalRule, OKTorrentCorrupted, KOTorrentCorrupted, corrupted)
+}
+
+func GenerateSpectrograms(release *music.Release, backend string, jobs int, generateCombined, verbose bool) (string, error) {
+	// generating full spectrograms, and the slices for the overview, jobs tracks at a time.
+	var err error
+	if backend == SpectrogramsSox {
+		err = generateSoxSpectrograms(release, "propolis", jobs, generateCombined)
+	} else {
+		err = generateNativeSpectrograms(release, "propolis", jobs, generateCombined)
+	}
 	if err != nil {
 		return "", err
 	}
 	if generateCombined {
-		// combination of 10s slices from each song
+		// combination of 10s slices from each song, all slices already exist
 		return release.GenerateCombinedSpectrogram(verbose)
 	}
 	return "", nil
@@ -0,0 +1,149 @@
+package propolis
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	mflac "github.com/mewkiz/flac"
+	"gitlab.com/catastrophic/assistance/fs"
+)
+
+const (
+	sfvExt      = ".sfv"
+	md5Ext      = ".md5"
+	ffpExt      = ".ffp"
+	accuripExt  = ".accurip"
+	regexpSFV   = `^(.+?)\s+([0-9A-Fa-f]{8})$`
+	regexpMD5   = `^([0-9A-Fa-f]{32}) [ *](.+)$`
+	regexpBSD   = `^MD5 \((.+)\) = ([0-9A-Fa-f]{32})$`
+	regexpFFP   = `^(.+):([0-9A-Fa-f]{32})$`
+	utf8BOM     = "\ufeff"
+	commentChar = ";"
+)
+
+var checksumExtensions = []string{sfvExt, md5Ext, ffpExt}
+
+// checksumEntry is a file listed in a checksum file, with its expected checksum.
+type checksumEntry struct {
+	// path of the file, relative to the checksum file
+	file     string
+	expected string
+}
+
+// checksumFile is a .sfv, .md5 or .ffp file.
+type checksumFile struct {
+	path    string
+	entries []checksumEntry
+}
+
+// parseChecksumFile of any supported kind.
+func parseChecksumFile(path string) (*checksumFile, error) {
+	var patterns []*regexp.Regexp
+	// for each pattern, index of the submatches for filename and checksum
+	var fileIndex, checksumIndex []int
+	switch strings.ToLower(filepath.Ext(path)) {
+	case sfvExt:
+		patterns = []*regexp.Regexp{regexp.MustCompile(regexpSFV)}
+		fileIndex, checksumIndex = []int{1}, []int{2}
+	case md5Ext:
+		patterns = []*regexp.Regexp{regexp.MustCompile(regexpMD5), regexp.MustCompile(regexpBSD)}
+		fileIndex, checksumIndex = []int{2, 1}, []int{1, 2}
+	case ffpExt:
+		patterns = []*regexp.Regexp{regexp.MustCompile(regexpFFP)}
+		fileIndex, checksumIndex = []int{1}, []int{2}
+	default:
+		return nil, fmt.Errorf("unsupported checksum file %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &checksumFile{path: path}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), utf8BOM))
+		if line == "" || strings.HasPrefix(line, commentChar) {
+			continue
+		}
+		for i, re := range patterns {
+			if hits := re.FindStringSubmatch(line); hits != nil {
+				// checksum files made on Windows use backslashes
+				file := filepath.FromSlash(strings.ReplaceAll(hits[fileIndex[i]], `\`, "/"))
+				c.entries = append(c.entries, checksumEntry{file: file, expected: strings.ToLower(hits[checksumIndex[i]])})
+				break
+			}
+		}
+	}
+	return c, scanner.Err()
+}
+
+// Verify all entries, returning the files not matching their checksum or that could not be read, and the entries for
+// files that do not exist in the release found in root.
+func (c *checksumFile) Verify(root string) ([]string, []string) {
+	var mismatches, stale []string
+	dir := filepath.Dir(c.path)
+	for _, e := range c.entries {
+		target := filepath.Join(dir, e.file)
+		if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			stale = append(stale, fmt.Sprintf("%s: %s is outside of the release", filepath.Base(c.path), e.file))
+			continue
+		}
+		if !fs.FileExists(target) {
+			stale = append(stale, fmt.Sprintf("%s: %s not found", filepath.Base(c.path), e.file))
+			continue
+		}
+		actual, err := c.checksum(target)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %s could not be read: %s", filepath.Base(c.path), e.file, err.Error()))
+			continue
+		}
+		if actual != e.expected {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %s has checksum %s, expected %s", filepath.Base(c.path), e.file, actual, e.expected))
+		}
+	}
+	return mismatches, stale
+}
+
+func (c *checksumFile) checksum(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(c.path)) {
+	case sfvExt:
+		return calculateCRC32(path)
+	case md5Ext:
+		return fs.CalculateMD5(path)
+	default:
+		return streamInfoMD5(path)
+	}
+}
+
+func calculateCRC32(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	crc := crc32.NewIEEE()
+	if _, err := io.Copy(crc, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(crc.Sum(nil)), nil
+}
+
+// streamInfoMD5 of a FLAC file, also known as its fingerprint.
+func streamInfoMD5(path string) (string, error) {
+	stream, err := mflac.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	return hex.EncodeToString(stream.Info.MD5sum[:]), nil
+}
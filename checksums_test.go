@@ -0,0 +1,135 @@
+package propolis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChecksumFile(t *testing.T) {
+	fmt.Println("+ Testing parseChecksumFile...")
+	check := assert.New(t)
+
+	cases := []struct {
+		name     string
+		content  string
+		expected []checksumEntry
+	}{
+		{
+			name:    "release.sfv",
+			content: utf8BOM + "; generated by a ripper\r\n\r\n01 - One.flac 3610A686\r\nCD2\\01 - Two.flac   0000abcd\r\nnot a checksum line\r\n",
+			expected: []checksumEntry{
+				{file: "01 - One.flac", expected: "3610a686"},
+				{file: filepath.Join("CD2", "01 - Two.flac"), expected: "0000abcd"},
+			},
+		},
+		{
+			name:    "release.MD5",
+			content: "5D41402ABC4B2A76B9719D911017C592 *01 - One.flac\n5d41402abc4b2a76b9719d911017c592  01 - Two.flac\nMD5 (CD2/03 - Three.flac) = 5d41402abc4b2a76b9719d911017c592\n",
+			expected: []checksumEntry{
+				{file: "01 - One.flac", expected: "5d41402abc4b2a76b9719d911017c592"},
+				{file: "01 - Two.flac", expected: "5d41402abc4b2a76b9719d911017c592"},
+				{file: filepath.Join("CD2", "03 - Three.flac"), expected: "5d41402abc4b2a76b9719d911017c592"},
+			},
+		},
+		{
+			name:    "release.ffp",
+			content: "01 - One: Intro.flac:95bae5e2c745bb3ca95ca3b135c943f4\n",
+			expected: []checksumEntry{
+				{file: "01 - One: Intro.flac", expected: "95bae5e2c745bb3ca95ca3b135c943f4"},
+			},
+		},
+		{
+			name:    "empty.sfv",
+			content: "; nothing\n",
+		},
+	}
+	dir := t.TempDir()
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		check.Nil(ioutil.WriteFile(path, []byte(c.content), 0600))
+		parsed, err := parseChecksumFile(path)
+		check.Nil(err, c.name)
+		if check.NotNil(parsed, c.name) {
+			check.Equal(c.expected, parsed.entries, c.name)
+		}
+	}
+	_, err := parseChecksumFile(filepath.Join(dir, "release.sha1"))
+	check.NotNil(err)
+	_, err = parseChecksumFile(filepath.Join(dir, "missing.sfv"))
+	check.NotNil(err)
+}
+
+func TestChecksumFileVerify(t *testing.T) {
+	fmt.Println("+ Testing checksumFile.Verify...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	check.Nil(ioutil.WriteFile(filepath.Join(dir, "one.txt"), []byte("hello"), 0600))
+	check.Nil(ioutil.WriteFile(filepath.Join(dir, "two.txt"), []byte("hello!"), 0600))
+	track, err := ioutil.ReadFile(filepath.Join("testdata", "59996.flac"))
+	check.Nil(err)
+	check.Nil(ioutil.WriteFile(filepath.Join(dir, "track.flac"), track, 0600))
+
+	cases := []struct {
+		name       string
+		content    string
+		mismatches []string
+		stale      []string
+	}{
+		{
+			name:       "release.sfv",
+			content:    "one.txt 3610a686\ntwo.txt 3610a686\nthree.txt 3610a686\n",
+			mismatches: []string{"release.sfv: two.txt has checksum 9a86c960, expected 3610a686"},
+			stale:      []string{"release.sfv: three.txt not found"},
+		},
+		{
+			name:    "release.md5",
+			content: "5d41402abc4b2a76b9719d911017c592  one.txt\n",
+		},
+		{
+			// the fingerprint of a FLAC file is the MD5 of its decoded audio, from its STREAMINFO block
+			name:    "release.ffp",
+			content: "track.flac:95bae5e2c745bb3ca95ca3b135c943f4\n",
+		},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		check.Nil(ioutil.WriteFile(path, []byte(c.content), 0600))
+		parsed, err := parseChecksumFile(path)
+		check.Nil(err, c.name)
+		mismatches, stale := parsed.Verify(dir)
+		check.Equal(c.mismatches, mismatches, c.name)
+		check.Equal(c.stale, stale, c.name)
+		check.Nil(os.Remove(path))
+	}
+
+	// files that cannot be read are reported, and the other entries are still checked
+	path := filepath.Join(dir, "release.ffp")
+	check.Nil(ioutil.WriteFile(path, []byte("one.txt:95bae5e2c745bb3ca95ca3b135c943f4\ntrack.flac:00000000000000000000000000000000\n"), 0600))
+	parsed, err := parseChecksumFile(path)
+	check.Nil(err)
+	mismatches, stale := parsed.Verify(dir)
+	check.Empty(stale)
+	if check.Equal(2, len(mismatches)) {
+		check.Contains(mismatches[0], "release.ffp: one.txt could not be read: ")
+		check.Equal("release.ffp: track.flac has checksum 95bae5e2c745bb3ca95ca3b135c943f4, expected 00000000000000000000000000000000", mismatches[1])
+	}
+
+	// entries pointing outside of the release are not read
+	check.Nil(os.Mkdir(filepath.Join(dir, "CD1"), 0777))
+	path = filepath.Join(dir, "CD1", "disc.md5")
+	check.Nil(ioutil.WriteFile(path, []byte("5d41402abc4b2a76b9719d911017c592  ../one.txt\n5d41402abc4b2a76b9719d911017c592  ../../one.txt\n5d41402abc4b2a76b9719d911017c592 *..\\..\\release\\one.txt\n"), 0600))
+	parsed, err = parseChecksumFile(path)
+	check.Nil(err)
+	mismatches, stale = parsed.Verify(dir)
+	check.Empty(mismatches)
+	check.Equal([]string{
+		"disc.md5: " + filepath.Join("..", "..", "one.txt") + " is outside of the release",
+		"disc.md5: " + filepath.Join("..", "..", "release", "one.txt") + " is outside of the release",
+	}, stale)
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/docopt/docopt-go"
 	"github.com/pkg/errors"
 	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/strslice"
+	"gitlab.com/passelecasque/propolis"
 )
 
 const (
@@ -19,17 +23,50 @@ const (
 Description:
     Make sure files are in good shape before uploading.
     Detect trumpable releases.
+    FLAC tracks are always decoded to check their integrity, compression and channels. If the flac binary is
+    installed, they are also tested with it, as an extra integrity check.
 	
 Usage:
-    propolis [--metadata-root=<METADATA_PATH>] [--no-specs] [--no-overview] [--only-problems] [--snatched] [--json] <PATH>
+    propolis serve [--listen=<ADDRESS>] [--metadata-root=<METADATA_PATH>] [--spectrograms=<BACKEND>] [--jobs=<N>]
+    propolis [--metadata-root=<METADATA_PATH>] [--no-specs] [--no-overview] [--spectrograms=<BACKEND>] [--jobs=<N>] [--only-problems] [--snatched] [--json] [--html] [--description=<FORMAT>] [--description-template=<FILE>] [--export-upload=<FILE>] [--disable=<CHECKS>] [--manifest] [--no-cache] [--torrent=<FILE>] [--tracker=<URL>] [--musicbrainz=<URL>] [--source=<SOURCE>] <PATH>
+    propolis verify [--metadata-root=<METADATA_PATH>] [--snatched] <PATH>
+    propolis watch [--metadata-root=<METADATA_PATH>] [--jobs=<N>] [--snatched] [--disable=<CHECKS>] [--no-cache] [--source=<SOURCE>] <PATH>
+    propolis diff [--metadata-root=<METADATA_PATH>] [--jobs=<N>] [--snatched] [--disable=<CHECKS>] [--no-cache] <OLD> <NEW>
+    propolis compare [--metadata-root=<METADATA_PATH>] [--jobs=<N>] [--snatched] [--disable=<CHECKS>] [--no-cache] <PATH_A> <PATH_B>
+    propolis torrent [--metadata-root=<METADATA_PATH>] [--jobs=<N>] [--snatched] [--disable=<CHECKS>] [--no-cache] [--force] --announce=<URL> [--torrent-source=<SOURCE>] [--source=<SOURCE>] <PATH>
+
+Commands:
+    verify                           Compare the release with the manifest saved by a previous run.
+    watch                            Check the release again every time its files change, showing which checks changed.
+    diff                             Compare two JSON reports or release folders: fixed, regressed and changed checks.
+    compare                          Compare two releases of the same album, and decide if B trumps A.
+    torrent                          Check the release, and create a .torrent in the metadata folder if no problems were found.
+    serve                            Run an HTTP API to submit analyses, and get their reports and spectrograms.
 
 Options:
     --snatched                       Snatched mode: allow varroa metadata files, spec generated in <PATH>
     --no-specs                       Disable spectrograms generation.
     --no-overview                    Disable spectrograms overview.
+    --spectrograms=<BACKEND>         Generate spectrograms with: %s [default: native].
+    --jobs=<N>                       Number of tracks decoded or turned into spectrograms (with either backend) at the same time, 0 for one per CPU [default: 0].
     --only-problems                  Only show problems (warnings & errors).
     --json                           Toggles JSON output. Sets --only-problems to false.
+    --html                           Save a self-contained HTML report, with spectrograms, in the metadata folder.
+    --description=<FORMAT>           Save a release description for uploading, in: %s.
+    --description-template=<FILE>    Use this text/template file for the description instead of the default one.
+    --export-upload=<FILE>           Save the upload form fields, with a BBCode description, to this JSON file.
     --metadata-root=<METADATA_PATH>  Save propolis metadata inside this folder.
+    --disable=<CHECKS>               Comma-separated list of optional checks to disable (%s).
+    --manifest                       Save .md5, .sfv and .ffp manifests of the release if no problems were found.
+    --no-cache                       Analyse all tracks again instead of using cached results.
+    --announce=<URL>                 Announce URL of the tracker, with your passkey.
+    --source=<SOURCE>                Source of the release (%s), detected if not set.
+    --torrent-source=<SOURCE>        Source tag of the tracker, so that the torrent has a unique info-hash.
+    --force                          Create the torrent even if the release has problems.
+    --torrent=<FILE>                 Compare the release with this .torrent, found in varroa's metadata with --snatched.
+    --tracker=<URL>                  Look for duplicates on this Gazelle tracker, with the API key in $PROPOLIS_API_KEY.
+    --musicbrainz=<URL>              Compare tracks with the MusicBrainz release in their tags, using this web service (e.g. https://musicbrainz.org).
+    --listen=<ADDRESS>               Address the HTTP API listens on, analyses running one at a time [default: 127.0.0.1:7777].
     -h, --help                       Show this screen.
     --version                        Show version.
 `
@@ -41,18 +78,43 @@ var Version = "dev"
 
 type propolisArgs struct {
 	builtin              bool
+	verify               bool
+	watch                bool
+	diff                 bool
+	compare              bool
+	serve                bool
+	torrent              bool
+	force                bool
+	manifest             bool
+	disableCache         bool
 	disableSpecs         bool
 	disableCombinedSpecs bool
 	problemsOnly         bool
 	snatched             bool
 	jsonOutput           bool
+	htmlOutput           bool
+	description          string
+	descriptionTemplate  string
+	exportUpload         string
 	path                 string
+	oldPath              string
+	newPath              string
 	metadataRoot         string
+	spectrogramBackend   string
+	listen               string
+	announce             string
+	torrentSource        string
+	torrentFile          string
+	trackerURL           string
+	musicBrainzURL       string
+	source               string
+	jobs                 int
+	disabledChecks       []string
 }
 
 func (m *propolisArgs) parseCLI(osArgs []string) error {
 	// parse arguments and options
-	args, err := docopt.ParseArgs(fmt.Sprintf(usage, Version), osArgs, fmt.Sprintf(fullVersion, fullName, Version))
+	args, err := docopt.ParseArgs(fmt.Sprintf(usage, Version, strings.Join(propolis.SpectrogramBackends, ", "), strings.Join(propolis.DescriptionFormats, ", "), strings.Join(propolis.OptionalChecks, ", "), strings.Join(propolis.Sources, ", ")), osArgs, fmt.Sprintf(fullVersion, fullName, Version))
 	if err != nil {
 		return errors.Wrap(err, "incorrect arguments")
 	}
@@ -61,22 +123,45 @@ func (m *propolisArgs) parseCLI(osArgs []string) error {
 		m.builtin = true
 		return nil
 	}
+	m.verify = args["verify"].(bool)
+	m.watch = args["watch"].(bool)
+	m.diff = args["diff"].(bool)
+	m.compare = args["compare"].(bool)
+	m.serve = args["serve"].(bool)
+	m.torrent = args["torrent"].(bool)
+	m.force = args["--force"].(bool)
 	m.snatched = args["--snatched"].(bool)
 	m.disableSpecs = args["--no-specs"].(bool)
 	m.disableCombinedSpecs = args["--no-overview"].(bool)
 	m.problemsOnly = args["--only-problems"].(bool)
 	m.jsonOutput = args["--json"].(bool)
+	m.htmlOutput = args["--html"].(bool)
+	m.manifest = args["--manifest"].(bool)
+	m.disableCache = args["--no-cache"].(bool)
 	if m.jsonOutput {
 		m.problemsOnly = false
 	}
-	m.path = filepath.Clean(args["<PATH>"].(string))
-	if !fs.DirExists(m.path) {
-		return errors.New("target path " + m.path + " not found")
-	}
-	// if given current directory, going back up to find the current directory name
-	if m.path == "." {
-		cwd, _ := os.Getwd()
-		m.path = filepath.Join("..", filepath.Base(cwd))
+	if m.diff {
+		// comparing either JSON reports or release folders
+		if m.oldPath, err = reportPath(args["<OLD>"].(string)); err != nil {
+			return err
+		}
+		if m.newPath, err = reportPath(args["<NEW>"].(string)); err != nil {
+			return err
+		}
+	} else if m.compare {
+		if m.oldPath, err = releasePath(args["<PATH_A>"].(string)); err != nil {
+			return err
+		}
+		if m.newPath, err = releasePath(args["<PATH_B>"].(string)); err != nil {
+			return err
+		}
+	} else if m.serve {
+		if m.listen, err = args.String("--listen"); err != nil {
+			return errors.New("invalid listen address")
+		}
+	} else if m.path, err = releasePath(args["<PATH>"].(string)); err != nil {
+		return err
 	}
 
 	metadataRoot, err := args.String("--metadata-root")
@@ -87,8 +172,116 @@ func (m *propolisArgs) parseCLI(osArgs []string) error {
 		}
 	}
 
+	backend, err := args.String("--spectrograms")
+	if err == nil {
+		if !strslice.Contains(propolis.SpectrogramBackends, backend) {
+			return errors.New("unknown spectrogram backend " + backend)
+		}
+		m.spectrogramBackend = backend
+	}
+
+	if m.torrent {
+		if m.announce, err = args.String("--announce"); err != nil || m.announce == "" {
+			return errors.New("an announce URL is required to create a torrent")
+		}
+		m.torrentSource, _ = args.String("--torrent-source")
+	}
+	if source, err := args.String("--source"); err == nil {
+		if !strslice.Contains(propolis.Sources, source) {
+			return errors.New("unknown source " + source)
+		}
+		m.source = source
+	}
+
+	torrentFile, err := args.String("--torrent")
+	if err == nil {
+		if !fs.FileExists(torrentFile) {
+			return errors.New("torrent file " + torrentFile + " not found")
+		}
+		m.torrentFile = torrentFile
+	}
+
+	exportUpload, err := args.String("--export-upload")
+	if err == nil {
+		if !fs.DirExists(filepath.Dir(exportUpload)) {
+			return errors.New("cannot save the upload form in " + filepath.Dir(exportUpload) + ", folder not found")
+		}
+		m.exportUpload = exportUpload
+	}
+
+	trackerURL, err := args.String("--tracker")
+	if err == nil {
+		if _, err := url.ParseRequestURI(trackerURL); err != nil {
+			return errors.New("invalid tracker URL " + trackerURL)
+		}
+		m.trackerURL = trackerURL
+	}
+
+	musicBrainzURL, err := args.String("--musicbrainz")
+	if err == nil {
+		if _, err := url.ParseRequestURI(musicBrainzURL); err != nil {
+			return errors.New("invalid MusicBrainz URL " + musicBrainzURL)
+		}
+		m.musicBrainzURL = musicBrainzURL
+	}
+
+	description, err := args.String("--description")
+	if err == nil {
+		if !strslice.Contains(propolis.DescriptionFormats, description) {
+			return errors.New("unknown description format " + description)
+		}
+		m.description = description
+	}
+	descriptionTemplate, err := args.String("--description-template")
+	if err == nil {
+		if m.description == "" {
+			return errors.New("--description-template requires --description")
+		}
+		if !fs.FileExists(descriptionTemplate) {
+			return errors.New("description template " + descriptionTemplate + " not found")
+		}
+		m.descriptionTemplate = descriptionTemplate
+	}
+
+	jobs, err := args.Int("--jobs")
+	if err != nil || jobs < 0 {
+		return errors.New("--jobs must be a number, 0 or more")
+	}
+	m.jobs = jobs
+
+	disabled, err := args.String("--disable")
+	if err == nil {
+		for _, c := range strings.Split(disabled, ",") {
+			c = strings.TrimSpace(c)
+			if !strslice.Contains(propolis.OptionalChecks, c) {
+				return errors.New("unknown check " + c + ", cannot disable it")
+			}
+			m.disabledChecks = append(m.disabledChecks, c)
+		}
+	}
+
 	if m.snatched && m.metadataRoot != "" {
 		return errors.New("--snatched implies metadata will be saved inside the release folder, not compatible with --metadata-root")
 	}
 	return nil
 }
+
+func releasePath(arg string) (string, error) {
+	path := filepath.Clean(arg)
+	if !fs.DirExists(path) {
+		return "", errors.New("target path " + path + " not found")
+	}
+	// if given current directory, going back up to find the current directory name
+	if path == "." {
+		cwd, _ := os.Getwd()
+		path = filepath.Join("..", filepath.Base(cwd))
+	}
+	return path, nil
+}
+
+func reportPath(arg string) (string, error) {
+	if fs.FileExists(arg) {
+		return arg, nil
+	}
+	return releasePath(arg)
+}
@@ -1,44 +1,122 @@
 package main
 
 import (
-    "os"
-    "syscall"
+	"os"
+	"syscall"
 
-    "gitlab.com/catastrophic/assistance/logthis"
-    "gitlab.com/passelecasque/propolis"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/passelecasque/propolis"
 )
 
-type propolisArgs struct {
-    // Define the fields of propolisArgs struct here
-}
+func main() {
+	// parsing CLI
+	cli := &propolisArgs{}
+	if err := cli.parseCLI(os.Args[1:]); err != nil {
+		logthis.Error(err, logthis.NORMAL)
+		return
+	}
+	if cli.builtin {
+		return
+	}
 
-// Define Version constant
-const Version = "1.0.0"
+	if cli.verify {
+		results, err := propolis.Verify(cli.path, cli.metadataRoot, cli.snatched)
+		if err != nil {
+			logthis.Error(err, logthis.NORMAL)
+		}
+		if results.Errors != 0 {
+			syscall.Exit(1)
+		}
+		return
+	}
 
-func main() {
-    // checking external tools
-    if err := propolis.CheckExternalBinaries("sox", "flac"); err != nil {
-        logthis.Error(err, logthis.NORMAL)
-        return
-    }
-
-    // parsing CLI
-    cli := &propolisArgs{}
-    if err := cli.parseCLI(os.Args[1:]); err != nil {
-        logthis.Error(err, logthis.NORMAL)
-        return
-    }
-    if cli.builtin {
-        return
-    }
-
-    results, _, err := propolis.Run(cli.path, cli.metadataRoot, cli.disableSpecs, cli.disableCombinedSpecs, cli.problemsOnly, cli.snatched, cli.jsonOutput, true, Version)
-    if err != nil {
-        logthis.Error(err, logthis.NORMAL)
-    }
-
-    // returning nonzero exit status if something serious was found
-    if results.Errors != 0 {
-        syscall.Exit(1)
-    }
+	// checking external tools, flac is optional
+	if !cli.disableSpecs && cli.spectrogramBackend == propolis.SpectrogramsSox {
+		if err := propolis.CheckExternalBinaries("sox"); err != nil {
+			logthis.Error(err, logthis.NORMAL)
+			return
+		}
+	}
+	if err := propolis.CheckExternalBinaries("flac"); err != nil {
+		logthis.Info("flac is not available, using the built-in decoder for integrity checks.", logthis.VERBOSE)
+	}
+
+	options := propolis.Options{
+		MetadataRoot:         cli.metadataRoot,
+		DisableSpecs:         cli.disableSpecs,
+		DisableCombinedSpecs: cli.disableCombinedSpecs,
+		ProblemsOnly:         cli.problemsOnly,
+		Snatched:             cli.snatched,
+		JSONOutput:           cli.jsonOutput,
+		StdOutput:            true,
+		SpectrogramBackend:   cli.spectrogramBackend,
+		Jobs:                 cli.jobs,
+		DisabledChecks:       cli.disabledChecks,
+		Manifest:             cli.manifest,
+		DisableCache:         cli.disableCache,
+		HTMLOutput:           cli.htmlOutput,
+		Description:          cli.description,
+		DescriptionTemplate:  cli.descriptionTemplate,
+		TorrentFile:          cli.torrentFile,
+		TrackerURL:           cli.trackerURL,
+		TrackerAPIKey:        os.Getenv("PROPOLIS_API_KEY"),
+		ExportUpload:         cli.exportUpload,
+		MusicBrainzURL:       cli.musicBrainzURL,
+		Source:               cli.source,
+	}
+	if cli.diff {
+		before, err := propolis.LoadReport(cli.oldPath, options, Version)
+		if err != nil {
+			logthis.Error(err, logthis.NORMAL)
+			return
+		}
+		after, err := propolis.LoadReport(cli.newPath, options, Version)
+		if err != nil {
+			logthis.Error(err, logthis.NORMAL)
+			return
+		}
+		if propolis.CompareReports(before, after) != 0 {
+			syscall.Exit(1)
+		}
+		return
+	}
+
+	if cli.serve {
+		if err := propolis.NewServer(options, Version).Serve(cli.listen); err != nil {
+			logthis.Error(err, logthis.NORMAL)
+		}
+		return
+	}
+
+	if cli.torrent {
+		if err := propolis.MakeTorrent(cli.path, options, cli.announce, cli.torrentSource, cli.force, Version); err != nil {
+			logthis.Error(err, logthis.NORMAL)
+			syscall.Exit(1)
+		}
+		return
+	}
+
+	if cli.compare {
+		if !propolis.Compare(cli.oldPath, cli.newPath, options, Version) {
+			syscall.Exit(1)
+		}
+		return
+	}
+
+	if cli.watch {
+		if err := propolis.Watch(cli.path, options, Version); err != nil {
+			logthis.Error(err, logthis.NORMAL)
+		}
+		return
+	}
+
+	results, _, err := propolis.Run(cli.path, options, Version)
+	if err != nil {
+		logthis.Error(err, logthis.NORMAL)
+	}
+
+	// returning nonzero exit status if something serious was found
+	if results.Errors != 0 {
+		syscall.Exit(1)
+	}
 }
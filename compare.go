@@ -0,0 +1,271 @@
+package propolis
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/ui"
+)
+
+const (
+	// tracks with different titles are considered the same if their durations are this close, in seconds.
+	trackDurationTolerance = 2
+)
+
+// trumpCandidate is a release, with what matters when deciding if it trumps another.
+type trumpCandidate struct {
+	path           string
+	analysis       *Propolis
+	groups         map[string][]*Check
+	flacs          []*flac.Flac
+	paddedBits     bool
+	incompleteTags []string
+	logs           []*ripLog
+}
+
+func newTrumpCandidate(path string, options Options, version string) *trumpCandidate {
+	metadataDir := MetadataDir(path, options.MetadataRoot, options.Snatched)
+	analysis, groups := analyseChangedGroups(path, metadataDir, options, version, nil, nil)
+	analysis.ParseResults()
+	c := &trumpCandidate{path: path, analysis: analysis, groups: groups, flacs: analysis.release.Flacs}
+	if len(c.flacs) != 0 {
+		c.paddedBits, _ = analysis.checkForPaddedBits(c.flacs[0])
+	}
+	for _, f := range c.flacs {
+		if err := f.CheckMinimalTags(); err != nil {
+			c.incompleteTags = append(c.incompleteTags, filepath.Base(f.Path))
+		}
+	}
+	for _, l := range fs.GetAllowedFilesByExt(path, []string{".log"}) {
+		if log, err := readRipLog(l); err == nil {
+			c.logs = append(c.logs, log)
+		}
+	}
+	return c
+}
+
+// problems (warnings and errors) found in check groups.
+func (c *trumpCandidate) problems(titles ...string) int {
+	var count int
+	for _, t := range titles {
+		for _, check := range c.groups[t] {
+			if isProblem(check) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (c *trumpCandidate) bitDepth() int {
+	if len(c.flacs) == 0 {
+		return 0
+	}
+	return c.flacs[0].BitDepth
+}
+
+// logScore is the lowest score of all rip logs from known rippers, -1 without such logs.
+func (c *trumpCandidate) logScore() int {
+	score := -1
+	for _, l := range c.logs {
+		if l.ripper != ripperUnknown && (score == -1 || l.score < score) {
+			score = l.score
+		}
+	}
+	return score
+}
+
+func (c *trumpCandidate) logDescription() string {
+	if len(c.logs) == 0 {
+		return "no log"
+	}
+	var descriptions []string
+	for _, l := range c.logs {
+		d := fmt.Sprintf("%s (%s, %d)", l.path, l.ripper, l.score)
+		if len(l.deductions) != 0 {
+			d += ": " + strings.Join(l.deductions, ", ")
+		}
+		descriptions = append(descriptions, d)
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// trackPosition identifies a track in a release, with its disc and track numbers.
+type trackPosition struct {
+	disc, track int
+}
+
+func positionOf(f *flac.Flac) trackPosition {
+	tags := f.CommonTags()
+	position := trackPosition{disc: tagNumber(tags.DiscNumber), track: tagNumber(tags.TrackNumber)}
+	if position.disc == 0 {
+		position.disc = 1
+	}
+	return position
+}
+
+// missingTracks from a, that have no equivalent in b, either by disc and track number, by title or by duration.
+func missingTracks(a, b []*flac.Flac) []string {
+	matched := make([]bool, len(b))
+	byPosition := make(map[trackPosition]int)
+	for i, o := range b {
+		if p := positionOf(o); p.track != 0 {
+			byPosition[p] = i
+		}
+	}
+	var missing []string
+	for _, t := range a {
+		position := positionOf(t)
+		title := strings.ToLower(strings.TrimSpace(t.CommonTags().Title))
+		found := -1
+		if i, ok := byPosition[position]; ok && position.track != 0 && !matched[i] {
+			found = i
+		}
+		if found == -1 {
+			for i, o := range b {
+				if !matched[i] && title != "" && title == strings.ToLower(strings.TrimSpace(o.CommonTags().Title)) {
+					found = i
+					break
+				}
+			}
+		}
+		if found == -1 {
+			for i, o := range b {
+				if !matched[i] && math.Abs(float64(t.DurationSeconds-o.DurationSeconds)) <= trackDurationTolerance {
+					found = i
+					break
+				}
+			}
+		}
+		switch {
+		case found != -1:
+			matched[found] = true
+		case position.track != 0:
+			// file names are often the same on every disc
+			missing = append(missing, fmt.Sprintf("%s (disc %d, track %d)", filepath.Base(t.Path), position.disc, position.track))
+		default:
+			missing = append(missing, filepath.Base(t.Path))
+		}
+	}
+	return missing
+}
+
+// trumpCriterion compared between two releases.
+type trumpCriterion struct {
+	name string
+	a, b string
+	// better is -1 if A is better, 1 if B is better, 0 if they are equivalent.
+	better int
+	// trump is true if being better is enough for a release to trump the other.
+	trump bool
+}
+
+// compareCounts of problems, the release with fewer problems being better.
+func compareCounts(a, b int) int {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func compareTrumpCandidates(a, b *trumpCandidate) []trumpCriterion {
+	var criteria []trumpCriterion
+
+	// both releases should have the same tracks
+	missingFromB := missingTracks(a.flacs, b.flacs)
+	missingFromA := missingTracks(b.flacs, a.flacs)
+	tracks := trumpCriterion{name: "Tracks", trump: true, better: compareCounts(len(missingFromA), len(missingFromB))}
+	tracks.a = fmt.Sprintf("%d tracks", len(a.flacs))
+	if len(missingFromA) != 0 {
+		tracks.a += ", missing: " + strings.Join(missingFromA, ", ")
+	}
+	tracks.b = fmt.Sprintf("%d tracks", len(b.flacs))
+	if len(missingFromB) != 0 {
+		tracks.b += ", missing: " + strings.Join(missingFromB, ", ")
+	}
+	criteria = append(criteria, tracks)
+
+	// corrupt, uncompressed or MQA files
+	problemsA, problemsB := a.problems(TitleMusic), b.problems(TitleMusic)
+	criteria = append(criteria, trumpCriterion{"Music files", fmt.Sprintf("%d problem(s)", problemsA), fmt.Sprintf("%d problem(s)", problemsB), compareCounts(problemsA, problemsB), true})
+
+	// rip logs can only be compared between CD rips
+	logs := trumpCriterion{name: "Rip logs", a: a.logDescription(), b: b.logDescription(), trump: true}
+	if a.logScore() != -1 && b.logScore() != -1 {
+		logs.better = compareCounts(100-a.logScore(), 100-b.logScore())
+	}
+	criteria = append(criteria, logs)
+
+	// different bit depths can coexist, unless padded bits make a release fake high resolution
+	criteria = append(criteria, trumpCriterion{name: "Bit depth", a: fmt.Sprintf("%dbit", a.bitDepth()), b: fmt.Sprintf("%dbit", b.bitDepth())})
+	padded := trumpCriterion{name: "Padded bits", a: "no", b: "no", trump: true}
+	if a.paddedBits {
+		padded.a = "yes"
+		padded.better++
+	}
+	if b.paddedBits {
+		padded.b = "yes"
+		padded.better--
+	}
+	criteria = append(criteria, padded)
+
+	// bad tags and bad names are trumpable
+	criteria = append(criteria, trumpCriterion{"Tags", fmt.Sprintf("%d track(s) with incomplete tags", len(a.incompleteTags)), fmt.Sprintf("%d track(s) with incomplete tags", len(b.incompleteTags)), compareCounts(len(a.incompleteTags), len(b.incompleteTags)), true})
+	namingA, namingB := a.problems(TitleFilenames, TitleFoldername), b.problems(TitleFilenames, TitleFoldername)
+	criteria = append(criteria, trumpCriterion{"Naming", fmt.Sprintf("%d problem(s)", namingA), fmt.Sprintf("%d problem(s)", namingB), compareCounts(namingA, namingB), true})
+	return criteria
+}
+
+// Compare two releases of the same album, and decide if the second one trumps the first one.
+// It returns true if B trumps A.
+func Compare(pathA, pathB string, options Options, version string) bool {
+	logthis.Info(ui.YellowBold(ArrowHeader+"Comparing A: "+pathA+" with B: "+pathB), logthis.NORMAL)
+	options.DisableSpecs = true
+	a := newTrumpCandidate(pathA, options, version)
+	b := newTrumpCandidate(pathB, options, version)
+	logthis.Info(fmt.Sprintf("A: %s\nB: %s", a.analysis.Summary(), b.analysis.Summary()), logthis.NORMAL)
+
+	var reasons, blockers []string
+	for _, c := range compareTrumpCandidates(a, b) {
+		logthis.Info(titleHeader+ui.BlueBoldUnderlined(c.name), logthis.NORMAL)
+		bulletA, bulletB := NeutralString, NeutralString
+		switch c.better {
+		case 1:
+			bulletA, bulletB = WarningString, OKString
+			if c.trump {
+				reasons = append(reasons, c.name+": "+c.b)
+			}
+		case -1:
+			bulletA, bulletB = OKString, WarningString
+			if c.trump {
+				blockers = append(blockers, c.name+": "+c.b)
+			}
+		}
+		logthis.Info(fmt.Sprintf(" %2s | A: %s\n %2s | B: %s", bulletA, c.a, bulletB, c.b), logthis.NORMAL)
+	}
+
+	logthis.Info("\n"+titleHeader+ui.BlueBoldUnderlined("Verdict"), logthis.NORMAL)
+	switch {
+	case a.bitDepth() != b.bitDepth() && !a.paddedBits && !b.paddedBits:
+		logthis.Info(ui.Blue(KOTrumpDifferentFormats), logthis.NORMAL)
+		return false
+	case len(reasons) == 0:
+		logthis.Info(ui.Blue(KOTrumpNoReason), logthis.NORMAL)
+		return false
+	case len(blockers) != 0:
+		logthis.Info(ui.Yellow(KOTrumpWorse+strings.Join(blockers, " | ")), logthis.NORMAL)
+		return false
+	default:
+		logthis.Info(ui.GreenBold(OKTrump+strings.Join(reasons, " | ")), logthis.NORMAL)
+		return true
+	}
+}
@@ -0,0 +1,133 @@
+package propolis
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/flac"
+)
+
+func TestMissingTracks(t *testing.T) {
+	fmt.Println("+ Testing missingTracks...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	track := func(release, name string, seconds int, tags ...string) *flac.Flac {
+		return writeTestFlac(t, filepath.Join(dir, release, name), 1, seconds*testSampleRate, noise, tags...)
+	}
+	a := []*flac.Flac{
+		track("A", "01.flac", 1, "TITLE=One"),
+		track("A", "02.flac", 5, "TITLE=Two"),
+		track("A", "03.flac", 9, "TITLE=Three"),
+	}
+	b := []*flac.Flac{
+		// same title, different case and duration
+		track("B", "01 - one.flac", 3, "TITLE= one"),
+		// different title, close enough duration
+		track("B", "02 - deux.flac", 6, "TITLE=Deux"),
+		track("B", "04 - bonus.flac", 1),
+	}
+	check.Equal([]string{"03.flac"}, missingTracks(a, b))
+	check.Equal([]string{"04 - bonus.flac"}, missingTracks(b, a))
+	check.Empty(missingTracks(a, a))
+	check.Equal([]string{"01.flac", "02.flac", "03.flac"}, missingTracks(a, nil))
+	// a track can only be matched once
+	check.Equal([]string{"01.flac"}, missingTracks([]*flac.Flac{a[0], a[0]}, b[:1]))
+
+	// disc and track numbers come first, whatever the titles and durations
+	discs := []*flac.Flac{
+		track("C", "CD1/01.flac", 1, "DISCNUMBER=1", "TRACKNUMBER=1", "TITLE=Intro"),
+		track("C", "CD2/01.flac", 9, "DISCNUMBER=2", "TRACKNUMBER=1", "TITLE=Outro"),
+	}
+	remaster := []*flac.Flac{
+		track("D", "01 - intro.flac", 5, "TRACKNUMBER=1", "TITLE=Intro (Remastered)"),
+		track("D", "02 - outro.flac", 1, "DISCNUMBER=2", "TRACKNUMBER=1", "TITLE=Outro (Remastered)"),
+	}
+	check.Empty(missingTracks(discs, remaster))
+	check.Empty(missingTracks(remaster, discs))
+	check.Equal([]string{"01.flac (disc 2, track 1)"}, missingTracks(discs, remaster[:1]))
+}
+
+func TestCompareTrumpCandidates(t *testing.T) {
+	fmt.Println("+ Testing compareTrumpCandidates...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	flacs := []*flac.Flac{
+		writeTestFlac(t, filepath.Join(dir, "01.flac"), 1, testSampleRate, noise, "TITLE=One"),
+		writeTestFlac(t, filepath.Join(dir, "02.flac"), 1, 5*testSampleRate, noise, "TITLE=Two"),
+	}
+	problems := func(results ...Result) []*Check {
+		var checks []*Check
+		for _, r := range results {
+			checks = append(checks, &Check{Result: r})
+		}
+		return checks
+	}
+
+	a := &trumpCandidate{
+		flacs: flacs,
+		groups: map[string][]*Check{
+			TitleMusic:      problems(OK, OK),
+			TitleFilenames:  problems(Warning, KO),
+			TitleFoldername: problems(OK),
+		},
+		logs:           []*ripLog{{path: "a.log", ripper: ripperEAC, score: 95, deductions: []string{"no test & copy"}}},
+		incompleteTags: []string{"02.flac"},
+	}
+	b := &trumpCandidate{
+		flacs: flacs[:1],
+		groups: map[string][]*Check{
+			TitleMusic:      problems(KO, OK),
+			TitleFilenames:  problems(OK),
+			TitleFoldername: problems(OK),
+		},
+		logs:       []*ripLog{{path: "b.log", ripper: ripperXLD, score: 100}},
+		paddedBits: true,
+	}
+
+	expected := []struct {
+		name   string
+		a, b   string
+		better int
+		trump  bool
+	}{
+		{"Tracks", "2 tracks", "1 tracks, missing: 02.flac", -1, true},
+		{"Music files", "0 problem(s)", "1 problem(s)", -1, true},
+		{"Rip logs", "a.log (EAC, 95): no test & copy", "b.log (XLD, 100)", 1, true},
+		{"Bit depth", "16bit", "16bit", 0, false},
+		{"Padded bits", "no", "yes", -1, true},
+		{"Tags", "1 track(s) with incomplete tags", "0 track(s) with incomplete tags", 1, true},
+		{"Naming", "2 problem(s)", "0 problem(s)", 1, true},
+	}
+	criteria := compareTrumpCandidates(a, b)
+	check.Equal(len(expected), len(criteria))
+	for i, e := range expected {
+		check.Equal(e.name, criteria[i].name)
+		check.Equal(e.a, criteria[i].a, e.name)
+		check.Equal(e.b, criteria[i].b, e.name)
+		check.Equal(e.better, criteria[i].better, e.name)
+		check.Equal(e.trump, criteria[i].trump, e.name)
+	}
+
+	// logs are not compared if one release has none
+	b.logs = nil
+	criteria = compareTrumpCandidates(a, b)
+	check.Equal("no log", criteria[2].b)
+	check.Equal(0, criteria[2].better)
+
+	// logs from unknown rippers are not compared either
+	b.logs = []*ripLog{{path: "b.log", ripper: ripperUnknown, score: 100}}
+	criteria = compareTrumpCandidates(a, b)
+	check.Equal(0, criteria[2].better)
+	b.logs = append(b.logs, &ripLog{path: "b2.log", ripper: ripperXLD, score: 90})
+	criteria = compareTrumpCandidates(a, b)
+	check.Equal(-1, criteria[2].better)
+
+	// a release is equivalent to itself
+	for _, c := range compareTrumpCandidates(a, a) {
+		check.Equal(0, c.better, c.name)
+	}
+}
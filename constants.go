@@ -8,9 +8,43 @@ const (
 	TitleMusic        = "Checking music files"
 	TitleOrganization = "Checking organization"
 	TitleTags         = "Checking tags"
+	TitleArtwork      = "Checking embedded artwork"
 	TitleFilenames    = "Checking filenames"
 	TitleExtraFiles   = "Checking extra files"
 	TitleFoldername   = "Checking folder name"
+	TitleChecksums    = "Checking checksum files"
+	TitleManifest     = "Comparing with manifest"
+	TitleTracker      = "Comparing with the tracker metadata"
+	TitleMusicBrainz  = "Comparing with MusicBrainz"
+	TitleDupes        = "Checking for duplicates on the tracker"
+	TitleTorrent      = "Comparing with the .torrent"
+	TitleSource       = "Checking source-specific rules"
+	TitleFixed        = "Fixed"
+	TitleRegressed    = "Regressed"
+	TitleChanged      = "Changed"
+	TitleStats        = "Stats"
+
+	StatsComparison = "%-8s checks: %3d -> %3d (%+d)"
+
+	// optional checks, which can be disabled by name.
+	CheckTagWhitespace        = "tag-whitespace"
+	CheckTagDuplicates        = "tag-duplicates"
+	CheckTagEmpty             = "tag-empty"
+	CheckTagFieldNames        = "tag-field-names"
+	CheckTagControlCharacters = "tag-control-characters"
+	CheckTagMojibake          = "tag-mojibake"
+	CheckTagCruft             = "tag-cruft"
+	CheckArtworkFrontCover    = "artwork-front-cover"
+	CheckArtworkMIME          = "artwork-mime"
+	CheckArtworkDimensions    = "artwork-dimensions"
+	CheckArtworkCorrupt       = "artwork-corrupt"
+	CheckArtworkConsistency   = "artwork-consistency"
+	CheckArtworkVsCover       = "artwork-vs-cover"
+	CheckCoverResolution      = "cover-resolution"
+	CheckCoverAspectRatio     = "cover-aspect-ratio"
+	CheckCoverFormat          = "cover-format"
+	CheckCoverTruncated       = "cover-truncated"
+	CheckCoverMatchesArtwork  = "cover-matches-artwork"
 
 	BlankBecauseImpossible = ""
 	OtherError             = "Other error"
@@ -30,20 +64,30 @@ const (
 	KOValidBitDepth           = "Bit depths exceeding maximum of 24."
 	OKSameSampleRate          = "All files have a sample rate of %sHz."
 	KOSameSampleRate          = "Release has a mix of sample rates, acceptable for some WEB releases (2.1.6.2)."
+	KOSameSampleRateWEB       = "Release has a mix of sample rates, acceptable for WEB releases."
+	KOSameSampleRateSource    = "Release has a mix of sample rates, which is not acceptable for %s releases."
 	OKValidSampleRate         = "All sample rates are less than or equal to 192kHz."
 	KOValidSampleRate         = "Sample rates exceeding maximum of 192kHz."
+	OKSameChannelCount        = "All files have %s channel(s)."
+	KOSameChannelCount        = "The tracks do not have the same number of channels: %s."
+	OKMultichannel            = "No multichannel tracks found."
+	KOMultichannel            = "Release contains multichannel tracks."
+	OKMonoAsStereo            = "Stereo tracks have different left and right channels."
+	KOMonoAsStereo            = "At least one stereo track has identical channels, it is mono audio stored as stereo."
+	OKInvertedPhase           = "No stereo track has an inverted channel."
+	KOInvertedPhase           = "At least one stereo track has a channel with inverted phase, it cancels out when played in mono."
 	OKBitRate                 = "All tracks have at least 192kbps bitrate (between %skbps and %skbps)."
 	KOBitRate                 = "At least one file has a lower than 192kbps bit rate (%skpbs)."
 	OKMuttRip                 = "Release does not also contain other kinds of music files."
 	KOMuttRip                 = "Release also contains other music formats, possible mutt rip: %s"
 	KOIntegrityCheck          = "At least one track is not a valid FLAC file."
 	KOID3Tags                 = "At least one FLAC has illegal ID3 tags"
-	KOIntegrity               = "At least one FLAC has failed an integrity test"
+	OKMD5Set                  = "All tracks have an MD5 signature in their STREAMINFO block."
+	KOMD5Set                  = "At least one track has an unset MD5 signature, its integrity cannot be fully verified."
 	OKID3v1Tags               = "No ID3v1 tags detected in the first track."
 	KOID3v1Tags               = "The first track contains ID3v1 tags at the end of the file."
-	OKUncompressedFlac        = "First track is not uncompressed FLAC."
-	KOUncompressedFlac        = "Error checking for uncompressed FLAC."
-	KOUncompressed            = "The first track is uncompressed FLAC"
+	OKUncompressedFlac        = "No track is uncompressed FLAC."
+	KOUncompressedFlac        = "Some tracks are uncompressed FLAC, or could not be checked."
 	OKNoMQAMetadata           = "The first track does not contain MQA encoder metadata."
 	KONoMQAMetadata           = "The first track contains MQA encoder metadata."
 	OKNoMQASyncword           = "The first track does not contain MQA syncwords."
@@ -75,6 +119,34 @@ const (
 	KOConsistentAlbumArtist   = "Artist/Album artist tags differ from file to file"
 	OKCombinedTrackNumber     = "Track number for the first track is not combined with track total."
 	KOCombinedTrackNumber     = "Track number for the first track is combined with track total."
+	OKTagWhitespace           = "No leading or trailing whitespace found in tag values."
+	KOTagWhitespace           = "At least one tag value has leading or trailing whitespace."
+	OKTagDuplicates           = "No duplicate tags found."
+	KOTagDuplicates           = "At least one track contains the same tag more than once."
+	OKTagEmpty                = "No empty tags found."
+	KOTagEmpty                = "At least one track contains empty tags."
+	OKTagFieldNames           = "All tag field names are in canonical form."
+	KOTagFieldNames           = "At least one tag field name is lowercase or non-standard."
+	OKTagControlCharacters    = "No control characters found in tag values."
+	KOTagControlCharacters    = "At least one tag value contains control characters."
+	OKTagMojibake             = "No double-encoded UTF-8 found in tag values."
+	KOTagMojibake             = "At least one tag value seems to be double-encoded UTF-8 (mojibake)."
+	OKTagCruft                = "No leftover ripper/tagger fields or URLs found in tags."
+	KOTagCruft                = "Tracks contain leftover ripper/tagger fields or URLs that should be removed."
+	OKNoArtwork               = "No embedded artwork found."
+	KOArtworkParsing          = "Could not read embedded artwork"
+	OKArtworkFrontCover       = "All tracks with embedded artwork have a front cover."
+	KOArtworkFrontCover       = "At least one track has embedded artwork, but no front cover."
+	OKArtworkMIME             = "All embedded pictures have a MIME type matching their actual format."
+	KOArtworkMIME             = "At least one embedded picture has a MIME type not matching its actual format."
+	OKArtworkDimensions       = "All embedded pictures have reasonable and correctly declared dimensions."
+	KOArtworkDimensions       = "At least one embedded picture is too small or has incorrectly declared dimensions."
+	OKArtworkCorrupt          = "All embedded pictures could be decoded."
+	KOArtworkCorrupt          = "At least one embedded picture is corrupt."
+	OKArtworkConsistency      = "All tracks have the same embedded front cover."
+	KOArtworkConsistency      = "Tracks have different embedded front covers."
+	OKArtworkVsCover          = "Embedded front cover is not larger than %s."
+	KOArtworkVsCover          = "Embedded front cover (%dx%d) is larger than %s (%dx%d). Suggestion: consider using it as the folder cover."
 	OKNotMissingFiles         = "All files are present"
 	KOMissingFiles            = "Checking for missing files"
 	OKValidCharacters         = "Tracks filenames do not appear to contain problematic characters."
@@ -106,8 +178,131 @@ const (
 	KOCDInFoldername          = "Since release contains .log/.cue, it seems to be sourced from CD. The folder name could mention it."
 	OKWEBInFoldername         = "Release does not contain .log/.cue files and the folder name properly mentions a WEB or Vinyl source."
 	KOWEBInFoldername         = "Since release does not .log/.cue, it is probably a WEB or Vinyl release. The folder name could mention it."
+	OKMP3InFoldername         = "Format (MP3) found in folder name."
+	KOMP3InFoldername         = "Format (MP3) not found in folder name."
+	OKEncodingInFoldername    = "Encoding (%s) found in folder name."
+	KOEncodingInFoldername    = "Encoding (%s) not found in folder name."
+	OKReleaseHasMP3s          = "Release contains %d MP3 files."
+	KOReleaseHasMP3s          = "At least one MP3 could not be read."
+	OKMP3Encoding             = "All tracks are %s MP3s."
+	KOMP3Encoding             = "Tracks have different encodings: %s."
+	OKMP3PreferredEncoding    = "The encoding is 320, V0 or V2."
+	KOMP3PreferredEncoding    = "The encoding is %s, the release could be trumped by a 320, V0 or V2 encode."
+	KOSameMP3Encoder          = "Tracks were encoded with different encoders: %s."
+	OKMP3LAME                 = "All tracks were encoded with LAME."
+	KOMP3LAME                 = "At least one track has no LAME header, it was encoded with another encoder or the header was stripped."
+	OKMP3MPEG1                = "All tracks are MPEG-1 layer III."
+	KOMP3MPEG1                = "At least one track is MPEG-2 or MPEG-2.5, with a low sample rate."
+	OKMP3Lowpass              = "LAME lowpass filters match the encoding settings."
+	KOMP3Lowpass              = "At least one track has a lower lowpass than expected for its encoding, it might be a transcode."
+	OKMP3ID3v2                = "All tracks have ID3v2 tags."
+	KOMP3ID3v2                = "At least one track does not have ID3v2 tags."
+	OKMP3ID3v2Version         = "All ID3v2 tags are ID3v2.3 or ID3v2.4."
+	KOMP3ID3v2Version         = "At least one track has obsolete ID3v2 tags."
+	OKMP3SameID3v2            = "All tracks have %s tags."
+	KOMP3SameID3v2            = "Tracks have different ID3v2 versions: %s."
+	OKMP3ID3v1                = "No ID3v1 tags found."
+	KOMP3ID3v1                = "Tracks also have ID3v1 tags, which are limited to 30 characters and should be removed."
+	KOLowerCaseMP3Extensions  = "At least one filename has an uppercase .MP3 extension."
+	KOMP3MultiDisc            = "Tracks in subfolders do not have a disc number"
+	OKSourceInFoldername      = "Source (%s) found in folder name."
+	KOSourceInFoldername      = "Source (%s) not found in folder name, it could mention it."
+	OKVinylSideNumbers        = "Tracks are numbered by vinyl side (A1, A2, B1...)."
+	OKSourceDetected          = "Source detected from the release files and folder name: %s."
+	KOSourceDetected          = "Could not detect the source of the release, use --source to declare it."
+	OKSourceDeclared          = "Declared source: %s."
+	KOSourceDeclared          = "The declared source is %s, but the release looks like a %s release."
+	OKSourceCDSpecs           = "All tracks are 16bit/44.1kHz, as CD audio."
+	KOSourceCDSpecs           = "CD rips must be 16bit/44.1kHz."
+	OKSourceCDLog             = "The CD rip has a log."
+	KOSourceCDLog             = "The CD rip has no log, it can be trumped by a rip with a log."
+	OKSourceLineage           = "The %s rip has a text file for its lineage."
+	KOSourceLineage           = "%s rips must describe their lineage (equipment, software) in a text file."
 	OKCoverFound              = "Release has a conventional %s in the top folder or in all disc subfolders."
 	KOCoverFound              = "Cannot find %s in top folder or in all disc subfolders, consider adding one or renaming the cover to that name."
+	KOCoverParsing            = "Could not read cover images"
+	OKCoverResolution         = "Cover images have a reasonable resolution."
+	KOCoverResolution         = "At least one cover image is too small or too large."
+	OKCoverAspectRatio        = "Cover images are square."
+	KOCoverAspectRatio        = "At least one cover image is not square."
+	OKCoverFormat             = "Cover images have extensions matching their actual format."
+	KOCoverFormat             = "At least one cover image has an extension not matching its actual format."
+	OKCoverTruncated          = "Cover images are complete and can be decoded."
+	KOCoverTruncated          = "At least one cover image is truncated or corrupt."
+	OKCoverMatchesArtwork     = "Cover images look like the embedded front cover."
+	KOCoverMatchesArtwork     = "At least one cover image does not look like the embedded front cover."
+	OKAccurateRipFiles        = "Release has %d .accurip file(s), which cannot be verified without the AccurateRip database."
+	OKNoChecksumFiles         = "Release does not contain .sfv, .md5 or .ffp files."
+	KOChecksumFileParsing     = "Could not check %s"
+	OKChecksumsMatch          = "All files listed in the %d checksum file(s) match their checksums."
+	KOChecksumsMatch          = "At least one file does not match the checksum listed in a .sfv, .md5 or .ffp file, or could not be read."
+	OKChecksumsStale          = "All files listed in checksum files are present."
+	KOChecksumsStale          = "Checksum files reference files that are not in the release."
+	OKChecksumsEmpty          = "All checksum files list at least one file."
+	KOChecksumsEmpty          = "Checksum files are empty or could not be understood."
+	OKManifestFound           = "Manifest found."
+	KOManifestFound           = "Could not read manifest, run propolis with --manifest first"
+	OKManifestRemoved         = "All files listed in the manifest are present."
+	KOManifestRemoved         = "Files listed in the manifest were removed."
+	OKManifestModified        = "All files match the manifest."
+	KOManifestModified        = "Files were modified since the manifest was generated."
+	OKManifestAdded           = "No files were added since the manifest was generated."
+	KOManifestAdded           = "Files were added since the manifest was generated."
+	KOTorrentProblems         = "The release has problems, not creating the torrent. Use --force to create it anyway."
+	ForcedTorrent             = "The release has problems, creating the torrent anyway."
+	OKTrackerMetadataFound    = "Found tracker metadata in %s."
+	KOTrackerMetadataFound    = "Could not read the tracker metadata saved by varroa"
+	OKTrackerFormat           = "The tracker lists the release as FLAC."
+	KOTrackerFormat           = "The tracker lists the release as %s, but it contains FLACs."
+	OKTrackerEncoding         = "The tracker encoding (%s) matches the bit depth of the tracks."
+	KOTrackerEncoding         = "The tracker encoding is %s, but the tracks are %s."
+	OKTrackerMediaCD          = "The tracker lists a CD, and the release has its log or cue."
+	KOTrackerMediaCD          = "The tracker lists a CD with a log or cue, but the release does not have any."
+	OKTrackerMedia            = "The tracker media (%s) is consistent with the release not having a log or cue."
+	KOTrackerMedia            = "The tracker lists the media as %s, but the release has a log or cue, which only CD rips should have."
+	OKTrackerAlbum            = "The tracker release title matches the album tag."
+	KOTrackerAlbum            = "The tracker release title (%s) does not match the album tag (%s)."
+	OKTrackerArtists          = "All artists listed on the tracker are found in the tags."
+	KOTrackerArtists          = "Artists listed on the tracker are not found in the tags."
+	OKTrackerYear             = "The tracker year matches the tags."
+	KOTrackerYear             = "The tracker year (%s) is not found in the tags."
+	OKTrackerLogScore         = "The logs score about %d%%, like on the tracker."
+	KOTrackerLogScore         = "The tracker lists a %d%% log score, but the logs seem to score more than %d points differently."
+	OKTrackerSearch           = "Searched the tracker for this release."
+	KOTrackerSearch           = "Could not search the tracker for duplicates"
+	OKTrackerExisting         = "Found %d torrent(s) of this release on the tracker."
+	OKTrackerDupes            = "No torrent with the same media, format and encoding was found."
+	KOTrackerDupes            = "Torrents with the same media, format and encoding already exist, this would be a dupe."
+	OKTrackerTrumpable        = "No existing torrent can be trumped by this release."
+	KOTrackerTrumpable        = "Existing torrents have worse logs, and could be trumped by this release."
+	OKNoMusicBrainzID         = "No MUSICBRAINZ_ALBUMID tag found, nothing to compare with MusicBrainz."
+	OKMusicBrainzID           = "All tracks point to the same MusicBrainz release."
+	KOMusicBrainzID           = "Tracks point to different MusicBrainz releases: %s."
+	OKMusicBrainzLookup       = "Found MusicBrainz release %s."
+	KOMusicBrainzLookup       = "Could not get the MusicBrainz release"
+	OKMusicBrainzTrackCount   = "The release has the same number of tracks as on MusicBrainz."
+	KOMusicBrainzTrackCount   = "The release has %d tracks, MusicBrainz has %d."
+	OKMusicBrainzDiscs        = "Discs have the same tracks as on MusicBrainz."
+	KOMusicBrainzDiscs        = "Discs do not have the same tracks as on MusicBrainz."
+	OKMusicBrainzTitles       = "Track titles match MusicBrainz."
+	KOMusicBrainzTitles       = "Track titles do not match MusicBrainz."
+	OKMusicBrainzDurations    = "Track durations match MusicBrainz."
+	KOMusicBrainzDurations    = "Track durations do not match MusicBrainz."
+	OKMusicBrainzBarcode      = "The barcode matches MusicBrainz."
+	KOMusicBrainzBarcode      = "The barcode (%s) does not match MusicBrainz (%s)."
+	OKTorrentFound            = "Found torrent %s."
+	KOTorrentFound            = "Could not read the .torrent of the release"
+	KONoTorrentFound          = "No .torrent found in TrackerMetadata, cannot check files were not modified since they were downloaded."
+	OKTorrentMissing          = "All files listed in the torrent are present."
+	KOTorrentMissing          = "Files listed in the torrent are missing."
+	OKTorrentExtra            = "No files were added to the torrent contents."
+	KOTorrentExtra            = "Files that are not in the torrent were added."
+	OKTorrentCorrupted        = "All files match the torrent pieces."
+	KOTorrentCorrupted        = "Files do not match the torrent, they were modified or corrupted."
+	OKTrump                   = "B trumps A: "
+	KOTrumpWorse              = "B does not trump A, it is worse on: "
+	KOTrumpNoReason           = "B does not trump A, neither release is better on what matters for a trump."
+	KOTrumpDifferentFormats   = "B does not trump A, releases with different bit depths can coexist."
 	OKExtraFiles              = "Release has %d accompanying files."
 	KOExtraFiles              = "Release does not have any kind of accompanying files. Suggestion: consider adding at least a cover."
 	OKExtraFilesSize          = "Total size of accompanying files: %sMb."
@@ -121,6 +316,11 @@ var (
 	nonFlacMusicExtensions = []string{".ac3", ".dts", ".m4a", ".m4b", ".mp3", ".mp4", ".aac", ".alac", ".ogg", ".opus"}
 	nonMusicExtensions     = []string{".accurip", ".azw3", ".chm", ".cue", ".djv", ".djvu", ".doc", ".dmg", ".epub", ".ffp", ".gif", ".htm", ".html", ".jpeg", ".jpg", ".lit", ".log", ".m3u", ".m3u8", ".md5", ".mobi", ".nfo", ".pdf", ".pls", ".png", ".rtf", ".sfv", ".txt"}
 
+	// OptionalChecks can be disabled by the user.
+	OptionalChecks = []string{CheckTagWhitespace, CheckTagDuplicates, CheckTagEmpty, CheckTagFieldNames, CheckTagControlCharacters, CheckTagMojibake, CheckTagCruft,
+		CheckArtworkFrontCover, CheckArtworkMIME, CheckArtworkDimensions, CheckArtworkCorrupt, CheckArtworkConsistency, CheckArtworkVsCover,
+		CheckCoverResolution, CheckCoverAspectRatio, CheckCoverFormat, CheckCoverTruncated, CheckCoverMatchesArtwork}
+
 	forbiddenCharacters        = []string{":", "*", `\`, "?", `"`, `<`, `>`, "|", "`"}
 	forbiddenLeadingCharacters = []string{" ", "."}
 )
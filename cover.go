@@ -0,0 +1,189 @@
+package propolis
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	minCoverDimension     = 500
+	maxCoverDimension     = 4000
+	maxCoverAspectRatio   = 1.1
+	maxCoverHashDistance  = 10
+	differenceHashColumns = 9
+	differenceHashRows    = 8
+)
+
+var (
+	coverNames      = []string{"cover", "folder", "front"}
+	coverExtensions = []string{".jpg", ".jpeg", ".png", ".gif"}
+	// file extensions expected for each format of the image package.
+	extensionsByFormat = map[string][]string{
+		"jpeg": {".jpg", ".jpeg"},
+		"png":  {".png"},
+		"gif":  {".gif"},
+	}
+	jpegEndMarker = []byte{0xFF, 0xD9}
+	pngEndChunk   = []byte("IEND")
+)
+
+// folderCover is an image file found in the release, used as cover.
+type folderCover struct {
+	path string
+	// format, width and height as found by actually decoding the image
+	format string
+	width  int
+	height int
+	hash   uint64
+	err    error
+	// truncated if the file does not end with the expected marker for its format
+	truncated bool
+}
+
+// getFolderCovers found anywhere in the release.
+func getFolderCovers(root string) ([]*folderCover, error) {
+	var covers []*folderCover
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		name := strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+		if !strslice.Contains(coverExtensions, ext) || !strslice.Contains(coverNames, name) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		covers = append(covers, decodeFolderCover(rel, data))
+		return nil
+	})
+	return covers, err
+}
+
+func decodeFolderCover(path string, data []byte) *folderCover {
+	c := &folderCover{path: path}
+	img, format, err := decodeImage(data)
+	c.format = format
+	if err != nil {
+		c.err = err
+		return c
+	}
+	c.width, c.height = img.Bounds().Dx(), img.Bounds().Dy()
+	c.hash = differenceHash(img)
+	// decoders can be lenient, checking the end of the file too
+	trimmed := bytes.TrimRight(data, "\x00")
+	switch format {
+	case "jpeg":
+		c.truncated = !bytes.HasSuffix(trimmed, jpegEndMarker)
+	case "png":
+		c.truncated = len(trimmed) < 12 || !bytes.Contains(trimmed[len(trimmed)-12:], pngEndChunk)
+	}
+	return c
+}
+
+// differenceHash is a perceptual hash: similar-looking images have hashes with a small Hamming distance.
+// Each bit indicates if a pixel is brighter than its right neighbour in a downscaled grayscale version of the image.
+func differenceHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, differenceHashColumns, differenceHashRows, imaging.Box))
+	var hash uint64
+	for y := 0; y < differenceHashRows; y++ {
+		for x := 0; x < differenceHashColumns-1; x++ {
+			hash <<= 1
+			if small.NRGBAAt(x, y).R > small.NRGBAAt(x+1, y).R {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func hashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func findCoverResolutionProblems(covers []*folderCover) []string {
+	var problems []string
+	for _, c := range covers {
+		if c.err != nil {
+			continue
+		}
+		if c.width < minCoverDimension || c.height < minCoverDimension {
+			problems = append(problems, fmt.Sprintf("%s: %dx%d is smaller than %dx%d", c.path, c.width, c.height, minCoverDimension, minCoverDimension))
+		}
+		if c.width > maxCoverDimension || c.height > maxCoverDimension {
+			problems = append(problems, fmt.Sprintf("%s: %dx%d is larger than %dx%d", c.path, c.width, c.height, maxCoverDimension, maxCoverDimension))
+		}
+	}
+	return problems
+}
+
+func findCoverAspectRatioProblems(covers []*folderCover) []string {
+	var problems []string
+	for _, c := range covers {
+		if c.err != nil {
+			continue
+		}
+		ratio := float64(c.width) / float64(c.height)
+		if math.Max(ratio, 1/ratio) > maxCoverAspectRatio {
+			problems = append(problems, fmt.Sprintf("%s: %dx%d is not square", c.path, c.width, c.height))
+		}
+	}
+	return problems
+}
+
+func findCoverFormatProblems(covers []*folderCover) []string {
+	var problems []string
+	for _, c := range covers {
+		if c.format == "" {
+			// could not even be identified, will be reported as truncated/corrupt
+			continue
+		}
+		if !strslice.Contains(extensionsByFormat[c.format], strings.ToLower(filepath.Ext(c.path))) {
+			problems = append(problems, fmt.Sprintf("%s: actual format is %s", c.path, c.format))
+		}
+	}
+	return problems
+}
+
+func findTruncatedCovers(covers []*folderCover) []string {
+	var problems []string
+	for _, c := range covers {
+		switch {
+		case c.err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %s", c.path, c.err.Error()))
+		case c.truncated:
+			problems = append(problems, fmt.Sprintf("%s: missing end of %s data", c.path, c.format))
+		}
+	}
+	return problems
+}
+
+// findCoversNotMatchingArtwork, comparing each cover with the largest embedded front cover.
+func findCoversNotMatchingArtwork(covers []*folderCover, embedded *embeddedArtwork) []string {
+	var problems []string
+	for _, c := range covers {
+		if c.err != nil {
+			continue
+		}
+		if distance := hashDistance(c.hash, embedded.hash); distance > maxCoverHashDistance {
+			problems = append(problems, fmt.Sprintf("%s: does not look like the front cover embedded in %s (distance: %d)", c.path, embedded.track, distance))
+		}
+	}
+	return problems
+}
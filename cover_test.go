@@ -0,0 +1,88 @@
+package propolis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-flac/flacpicture"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFolderCovers(t *testing.T) {
+	fmt.Println("+ Testing folder covers...")
+	check := assert.New(t)
+
+	png600 := encodeTestImage(t, "png", 600, 600, gradient(false))
+	jpeg1000 := encodeTestImage(t, "jpeg", 1000, 1000, gradient(false))
+	files := map[string][]byte{
+		"cover.jpg":        jpeg1000,
+		"folder.png":       png600,
+		"CD1/front.jpeg":   encodeTestImage(t, "jpeg", 300, 200, gradient(false)),
+		"CD2/cover.jpg":    png600,
+		"CD3/cover.png":    png600[:len(png600)-12],
+		"CD4/folder.jpg":   append(append([]byte{}, jpeg1000...), []byte("trailing junk")...),
+		"CD5/cover.gif":    []byte("not an image"),
+		"scans/back.jpg":   jpeg1000,
+		"scans/cover.webp": []byte("not checked"),
+	}
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		check.Nil(os.MkdirAll(filepath.Dir(path), 0777))
+		check.Nil(ioutil.WriteFile(path, data, 0600))
+	}
+	covers, err := getFolderCovers(dir)
+	check.Nil(err)
+	var paths []string
+	for _, c := range covers {
+		paths = append(paths, c.path)
+	}
+	check.Equal([]string{
+		filepath.Join("CD1", "front.jpeg"), filepath.Join("CD2", "cover.jpg"), filepath.Join("CD3", "cover.png"),
+		filepath.Join("CD4", "folder.jpg"), filepath.Join("CD5", "cover.gif"), "cover.jpg", "folder.png",
+	}, paths)
+
+	check.Equal([]string{paths[0] + ": 300x200 is smaller than 500x500"}, findCoverResolutionProblems(covers))
+	check.Equal([]string{paths[0] + ": 300x200 is not square"}, findCoverAspectRatioProblems(covers))
+	check.Equal([]string{paths[1] + ": actual format is png"}, findCoverFormatProblems(covers))
+	truncated := findTruncatedCovers(covers)
+	if check.Equal(3, len(truncated)) {
+		check.Contains(truncated[0], paths[2]+": ")
+		check.Equal(paths[3]+": missing end of jpeg data", truncated[1])
+		check.Equal(paths[4]+": image: unknown format", truncated[2])
+	}
+
+	// any registered format is decoded
+	bmpCover := decodeFolderCover("cover.jpg", encodeTestImage(t, "bmp", 600, 600, gradient(false)))
+	check.Nil(bmpCover.err)
+	check.Equal([]string{"cover.jpg: actual format is bmp"}, findCoverFormatProblems([]*folderCover{bmpCover}))
+	check.Empty(findTruncatedCovers([]*folderCover{bmpCover}))
+
+	large := decodeFolderCover("cover.jpg", encodeTestImage(t, "png", 4500, 100, gradient(false)))
+	check.Equal([]string{"cover.jpg: 4500x100 is smaller than 500x500", "cover.jpg: 4500x100 is larger than 4000x4000"}, findCoverResolutionProblems([]*folderCover{large}))
+}
+
+func TestCoverHashes(t *testing.T) {
+	fmt.Println("+ Testing cover hashes...")
+	check := assert.New(t)
+
+	check.Equal(0, hashDistance(0, 0))
+	check.Equal(64, hashDistance(0, ^uint64(0)))
+	check.Equal(2, hashDistance(0x0f, 0x3f))
+
+	embedded := decodeEmbeddedArtwork("01.flac", &flacpicture.MetadataBlockPicture{PictureType: flacpicture.PictureTypeFrontCover, MIME: "image/png", ImageData: encodeTestImage(t, "png", 600, 600, gradient(false))})
+	covers := []*folderCover{
+		// same picture, another size and format
+		decodeFolderCover("cover.jpg", encodeTestImage(t, "jpeg", 1000, 1000, gradient(false))),
+		decodeFolderCover("folder.png", encodeTestImage(t, "png", 500, 500, gradient(true))),
+		decodeFolderCover("broken.jpg", []byte("not an image")),
+	}
+	check.Equal(0, hashDistance(covers[0].hash, embedded.hash))
+	problems := findCoversNotMatchingArtwork(covers, embedded)
+	if check.Equal(1, len(problems)) {
+		check.Regexp(`^folder.png: does not look like the front cover embedded in 01.flac \(distance: [0-9]+\)$`, problems[0])
+	}
+}
@@ -0,0 +1,299 @@
+package propolis
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	DescriptionBBCode   = "bbcode"
+	DescriptionMarkdown = "markdown"
+)
+
+var (
+	DescriptionFormats = []string{DescriptionBBCode, DescriptionMarkdown}
+
+	descriptionFiles = map[string]string{
+		DescriptionBBCode:   "description.txt",
+		DescriptionMarkdown: "description.md",
+	}
+
+	// default templates, can be replaced with --description-template.
+	descriptionTemplates = map[string]string{
+		DescriptionBBCode: `[size=4][b]{{.Artist}} - {{.Album}}{{if .Year}} ({{.Year}}){{end}}[/b][/size]
+{{if .Label}}[b]Label:[/b] {{.Label}}
+{{end}}
+[b]Tracklist[/b]
+{{range .Tracks}}[b]{{if .Disc}}{{.Disc}}.{{end}}{{.Number}}.[/b] {{if $.VariousArtists}}{{.Artist}} - {{end}}{{.Title}} [i]({{.Duration}})[/i]
+{{end}}
+[b]Total length:[/b] {{.TotalDuration}}
+
+[b]Specs:[/b] {{.Format}} {{if .BitDepth}}{{.BitDepth}}bit{{else}}{{.Encoding}}{{end}} / {{.SampleRate}}, {{.Channels}}
+[b]Encoder:[/b] {{.Encoder}}
+[b]Source:[/b] {{.Source}}
+[b]Lineage:[/b] {{.Lineage}}
+{{if .Spectrograms}}[b]Spectrograms:[/b] {{.Spectrograms}}
+{{end}}`,
+		DescriptionMarkdown: `## {{.Artist}} - {{.Album}}{{if .Year}} ({{.Year}}){{end}}
+{{if .Label}}
+**Label:** {{.Label}}
+{{end}}
+### Tracklist
+
+{{range .Tracks}}{{if .Disc}}{{.Disc}}.{{end}}{{.Number}}. {{if $.VariousArtists}}{{.Artist}} - {{end}}{{.Title}} *({{.Duration}})*
+{{end}}
+**Total length:** {{.TotalDuration}}
+
+- **Specs:** {{.Format}} {{if .BitDepth}}{{.BitDepth}}bit{{else}}{{.Encoding}}{{end}} / {{.SampleRate}}, {{.Channels}}
+- **Encoder:** {{.Encoder}}
+- **Source:** {{.Source}}
+- **Lineage:** {{.Lineage}}
+{{if .Spectrograms}}- **Spectrograms:** {{.Spectrograms}}
+{{end}}`,
+	}
+
+	// lineage cannot be guessed, leaving placeholders for the uploader, by source.
+	lineagePlaceholders = map[string]string{
+		sourceCD:       "[CD pressing / catalogue number, drive, ripper]",
+		sourceWEB:      "[store the files were bought from]",
+		sourceVinyl:    "[turntable > cartridge > phono preamp > ADC > software]",
+		sourceSACD:     "[SACD player / ripping method, DSD to PCM conversion]",
+		sourceDAT:      "[DAT deck > interface > software]",
+		sourceCassette: "[tape deck > ADC > software]",
+		sourceUnknown:  "[where the files come from]",
+	}
+)
+
+type descriptionTrack struct {
+	Disc     string
+	Number   string
+	Artist   string
+	Title    string
+	Duration string
+}
+
+// releaseDescription holds what can be used in description templates.
+type releaseDescription struct {
+	Artist         string
+	Album          string
+	Year           string
+	Label          string
+	VariousArtists bool
+	Tracks         []descriptionTrack
+	TotalDuration  string
+	Format         string
+	// Encoding as in Gazelle upload forms, BitDepth is only set for FLAC releases.
+	Encoding     string
+	BitDepth     int
+	SampleRate   string
+	Channels     string
+	Encoder      string
+	Source       string
+	Lineage      string
+	Spectrograms string
+}
+
+func formatDuration(seconds float64) string {
+	total := int(seconds + 0.5)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total%3600/60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// channelsDescription for a number of channels.
+func channelsDescription(count int) string {
+	switch count {
+	case 1:
+		return "mono"
+	case 2:
+		return "stereo"
+	default:
+		return fmt.Sprintf("%d channels", count)
+	}
+}
+
+// setArtist from the track artists if there is no album artist.
+func (d *releaseDescription) setArtist(albumArtist string, artists []string) {
+	d.Artist = albumArtist
+	strslice.RemoveDuplicates(&artists)
+	// same rule as for folder names: 3 artists or more is VA
+	d.VariousArtists = len(artists) >= 3
+	if d.Artist == "" {
+		if d.VariousArtists {
+			d.Artist = "Various Artists"
+		} else {
+			d.Artist = strings.Join(artists, " & ")
+		}
+	}
+}
+
+func (p *Propolis) describe(overviewFile string) releaseDescription {
+	d := releaseDescription{Source: p.source()}
+	d.Lineage = lineagePlaceholders[d.Source]
+	if overviewFile != "" {
+		d.Spectrograms = filepath.Base(overviewFile)
+	}
+	switch {
+	case len(p.release.Flacs) != 0:
+		p.describeFlacs(&d)
+	case len(p.mp3s) != 0:
+		p.describeMP3s(&d)
+	}
+	return d
+}
+
+func (p *Propolis) describeFlacs(d *releaseDescription) {
+	first := p.release.Flacs[0]
+	tags := first.CommonTags()
+	d.Album, d.Year, d.Label = tags.Album, tags.Year, tags.Label
+	if d.Year == "" && len(tags.Date) >= 4 {
+		d.Year = tags.Date[:4]
+	}
+	var artists []string
+	var total float64
+	// mixed releases are described with their highest specs, as their encoding is
+	var bitDepth, sampleRate, channels int
+	for _, f := range p.release.Flacs {
+		t := f.CommonTags()
+		artists = append(artists, t.Artist...)
+		total += float64(f.DurationSeconds)
+		if f.BitDepth > bitDepth {
+			bitDepth = f.BitDepth
+		}
+		if f.SampleRate > sampleRate {
+			sampleRate = f.SampleRate
+		}
+		if f.ChannelCount > channels {
+			channels = f.ChannelCount
+		}
+		d.Tracks = append(d.Tracks, descriptionTrack{Disc: t.DiscNumber, Number: t.TrackNumber, Artist: strings.Join(t.Artist, ", "), Title: t.Title, Duration: formatDuration(float64(f.DurationSeconds))})
+	}
+	d.setArtist(strings.Join(tags.AlbumArtist, ", "), artists)
+	// disc numbers are only useful for multi-disc releases
+	if tags.TotalDiscs == "" || tags.TotalDiscs == "1" {
+		for i := range d.Tracks {
+			d.Tracks[i].Disc = ""
+		}
+	}
+	d.TotalDuration = formatDuration(total)
+
+	d.Format, d.Encoding, d.BitDepth = formatFLAC, encodingLossless, bitDepth
+	if d.BitDepth == 24 {
+		d.Encoding = encoding24bitLossless
+	}
+	d.SampleRate = fmt.Sprintf("%gkHz", float64(sampleRate)/1000)
+	d.Channels = channelsDescription(channels)
+	if err := p.release.CheckVendor(); err != nil {
+		d.Encoder = "various encoders"
+	} else {
+		d.Encoder = first.Vendor()
+	}
+}
+
+func (p *Propolis) describeMP3s(d *releaseDescription) {
+	tracks := make([]*mp3Track, len(p.mp3s))
+	copy(tracks, p.mp3s)
+	sort.SliceStable(tracks, func(i, j int) bool {
+		di, ti := mp3TrackPosition(tracks[i])
+		dj, tj := mp3TrackPosition(tracks[j])
+		return di < dj || di == dj && ti < tj
+	})
+	first := tracks[0]
+	d.Album, d.Year = first.Album, first.Year
+	if len(d.Year) > 4 {
+		d.Year = d.Year[:4]
+	}
+	var artists, encodings, encoders []string
+	var total float64
+	var sampleRate, channels int
+	multiDisc := false
+	for _, t := range tracks {
+		artists = append(artists, t.Artist)
+		if t.SampleRate > sampleRate {
+			sampleRate = t.SampleRate
+		}
+		if t.Channels > channels {
+			channels = t.Channels
+		}
+		encodings = append(encodings, t.Encoding())
+		encoders = append(encoders, t.Encoder)
+		total += t.DurationSeconds
+		if disc, _ := mp3TrackPosition(t); disc != 1 {
+			multiDisc = true
+		}
+		d.Tracks = append(d.Tracks, descriptionTrack{Disc: t.DiscNumber, Number: t.TrackNumber, Artist: t.Artist, Title: t.Title, Duration: formatDuration(t.DurationSeconds)})
+	}
+	d.setArtist(first.AlbumArtist, artists)
+	for i := range d.Tracks {
+		if multiDisc {
+			d.Tracks[i].Disc = strings.Split(d.Tracks[i].Disc, "/")[0]
+		} else {
+			d.Tracks[i].Disc = ""
+		}
+		d.Tracks[i].Number = strings.Split(d.Tracks[i].Number, "/")[0]
+	}
+	d.TotalDuration = formatDuration(total)
+
+	d.Format = formatMP3
+	strslice.RemoveDuplicates(&encodings)
+	if len(encodings) == 1 {
+		d.Encoding = encodings[0]
+	} else {
+		d.Encoding = encodingOther
+	}
+	d.SampleRate = fmt.Sprintf("%gkHz", float64(sampleRate)/1000)
+	d.Channels = channelsDescription(channels)
+	strslice.RemoveDuplicates(&encoders)
+	switch {
+	case len(encoders) != 1:
+		d.Encoder = "various encoders"
+	case encoders[0] == "":
+		d.Encoder = "unknown encoder"
+	default:
+		d.Encoder = encoders[0]
+	}
+}
+
+// renderDescription of the release in bbcode or markdown, using templateFile instead of the default template if it is
+// set.
+func (p *Propolis) renderDescription(format, templateFile, overviewFile string) (string, error) {
+	text, ok := descriptionTemplates[format]
+	if !ok {
+		return "", errors.New("unknown description format " + format)
+	}
+	if templateFile != "" {
+		data, err := ioutil.ReadFile(templateFile)
+		if err != nil {
+			return "", errors.Wrap(err, "could not read description template")
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New(format).Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid description template")
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, p.describe(overviewFile)); err != nil {
+		return "", errors.Wrap(err, "could not generate description")
+	}
+	return buffer.String(), nil
+}
+
+// SaveDescription of the release in dir, see renderDescription.
+func (p *Propolis) SaveDescription(dir, format, templateFile, overviewFile string) (string, error) {
+	description, err := p.renderDescription(format, templateFile, overviewFile)
+	if err != nil {
+		return "", err
+	}
+	outputFile := filepath.Join(dir, descriptionFiles[format])
+	return outputFile, ioutil.WriteFile(outputFile, []byte(description), 0600)
+}
@@ -0,0 +1,52 @@
+package propolis
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/music"
+)
+
+func TestDescribeFlacs(t *testing.T) {
+	fmt.Println("+ Testing describe...")
+	check := assert.New(t)
+
+	root := filepath.Join(t.TempDir(), "Artist - Album (2020) [WEB FLAC]")
+	release := music.New(root)
+	for i, artist := range []string{"One", "Two", "Three"} {
+		release.Flacs = append(release.Flacs, writeTestFlac(t, filepath.Join(root, fmt.Sprintf("%02d.flac", i+1)), 2, testSampleRate, noise,
+			"ALBUM=Album", "DATE=2020-01-31", "ARTIST="+artist, fmt.Sprintf("TRACKNUMBER=%d", i+1), fmt.Sprintf("TITLE=Track %d", i+1)))
+	}
+	p := NewPropolis(root, release, false)
+
+	d := p.describe("")
+	check.Equal("Various Artists", d.Artist)
+	check.True(d.VariousArtists)
+	check.Equal("2020", d.Year)
+	check.Equal(3, len(d.Tracks))
+	check.Equal("0:03", d.TotalDuration)
+	check.Equal(16, d.BitDepth)
+	check.Equal(encodingLossless, d.Encoding)
+	check.Equal("44.1kHz", d.SampleRate)
+	check.Equal("stereo", d.Channels)
+
+	// mixed releases are described with their highest specs, whatever the first track
+	release.Flacs[1].BitDepth, release.Flacs[1].SampleRate = 24, 96000
+	release.Flacs[2].ChannelCount = 6
+	d = p.describe("")
+	check.Equal(24, d.BitDepth)
+	check.Equal(encoding24bitLossless, d.Encoding)
+	check.Equal("96kHz", d.SampleRate)
+	check.Equal("6 channels", d.Channels)
+	description, err := p.renderDescription(DescriptionBBCode, "", "")
+	check.Nil(err)
+	check.Contains(description, "[b]Specs:[/b] FLAC 24bit / 96kHz, 6 channels")
+
+	// two artists are not VA
+	release.Flacs = release.Flacs[:2]
+	d = p.describe("")
+	check.Equal("One & Two", d.Artist)
+	check.False(d.VariousArtists)
+}
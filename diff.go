@@ -0,0 +1,168 @@
+package propolis
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/ui"
+)
+
+var numbersRegexp = regexp.MustCompile(`[0-9]+`)
+
+// identifyChecks gives an ID to every check, which stays the same across runs as long as the same kind of check is
+// made: numbers (sizes, counts...) are ignored, and identical checks are numbered in order of appearance.
+// Checks loaded from JSON reports keep their ID.
+func identifyChecks(checks []*Check) {
+	seen := make(map[string]int)
+	for _, c := range checks {
+		if c.ConditionOK == "" && c.ConditionKO == "" {
+			continue
+		}
+		key := c.Rule + "|" + numbersRegexp.ReplaceAllString(c.ConditionOK, "#") + "|" + numbersRegexp.ReplaceAllString(c.ConditionKO, "#")
+		seen[key]++
+		hash := sha1.Sum([]byte(key))
+		c.ID = fmt.Sprintf("%x-%d", hash[:4], seen[key])
+	}
+}
+
+// checkChange of a check between two analyses.
+// before or after is nil if the check only exists in one of them.
+type checkChange struct {
+	before *Check
+	after  *Check
+}
+
+func (c checkChange) String() string {
+	switch {
+	case c.before == nil:
+		return fmt.Sprintf("new      %s", c.after.String())
+	case c.after == nil:
+		return fmt.Sprintf("gone     %s", c.before.String())
+	case c.before.Result == c.after.Result:
+		return fmt.Sprintf("was      %s\n   now   %s", c.before.String(), c.after.String())
+	default:
+		return fmt.Sprintf("%s -> %s %s", simplifyBullet(c.before.Bullet), simplifyBullet(c.after.Bullet), c.after.String())
+	}
+}
+
+// resultChanged if a check changed result, or if a problem appeared or disappeared.
+func (c checkChange) resultChanged() bool {
+	switch {
+	case c.before == nil:
+		return isProblem(c.after)
+	case c.after == nil:
+		return isProblem(c.before)
+	default:
+		return c.before.Result != c.after.Result
+	}
+}
+
+// fixed problems are either gone or not problems anymore.
+func (c checkChange) fixed() bool {
+	return c.before != nil && isProblem(c.before) && (c.after == nil || c.after.Result < c.before.Result)
+}
+
+// regressed checks are new problems, or worse than before.
+func (c checkChange) regressed() bool {
+	return c.after != nil && isProblem(c.after) && (c.before == nil || c.after.Result > c.before.Result)
+}
+
+// diffChecks returns the checks that changed in any way, with checks matched by ID.
+func diffChecks(before, after []*Check) []checkChange {
+	identifyChecks(before)
+	identifyChecks(after)
+	var changes []checkChange
+	previous := make(map[string]*Check)
+	for _, c := range before {
+		previous[c.ID] = c
+	}
+	current := make(map[string]bool)
+	for _, c := range after {
+		current[c.ID] = true
+		b, ok := previous[c.ID]
+		switch {
+		case !ok:
+			changes = append(changes, checkChange{after: c})
+		case b.Result != c.Result || b.ResultComment != c.ResultComment:
+			changes = append(changes, checkChange{before: b, after: c})
+		}
+	}
+	for _, c := range before {
+		if !current[c.ID] {
+			changes = append(changes, checkChange{before: c})
+		}
+	}
+	return changes
+}
+
+func isProblem(c *Check) bool {
+	return c.Result == Warning || c.Result == KO
+}
+
+// LoadReport from a file saved with --json, or by analysing a release folder.
+func LoadReport(path string, options Options, version string) (*Propolis, error) {
+	if fs.DirExists(path) {
+		options.StdOutput = false
+		options.JSONOutput = false
+		options.DisableSpecs = true
+		analysis, _, err := Run(path, options, version)
+		analysis.ToggleStdOutput(true)
+		return analysis, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// the JSON output can be preceded by log lines
+	if start := strings.Index(string(data), "\n{"); start != -1 && data[0] != '{' {
+		data = data[start+1:]
+	}
+	var report Propolis
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, errors.Wrap(err, "could not read report "+path)
+	}
+	for _, c := range report.Checks {
+		c.Bullet = c.Result.bullet()
+	}
+	return &report, nil
+}
+
+// CompareReports and show which checks were fixed, which regressed, and which changed comment.
+// It returns the number of regressions.
+func CompareReports(before, after *Propolis) int {
+	var fixed, regressed, changed []checkChange
+	for _, c := range diffChecks(before.Checks, after.Checks) {
+		switch {
+		case c.fixed():
+			fixed = append(fixed, c)
+		case c.regressed():
+			regressed = append(regressed, c)
+		case c.before != nil && c.after != nil:
+			changed = append(changed, c)
+		}
+	}
+	logthis.Info(ui.YellowBold(ArrowHeader+"Comparing "+before.Path+" with "+after.Path), logthis.NORMAL)
+	for _, section := range []struct {
+		title   string
+		changes []checkChange
+	}{{TitleFixed, fixed}, {TitleRegressed, regressed}, {TitleChanged, changed}} {
+		logthis.Info(titleHeader+ui.BlueBoldUnderlined(fmt.Sprintf("%s (%d)", section.title, len(section.changes))), logthis.NORMAL)
+		for _, c := range section.changes {
+			logthis.Info(c.String(), logthis.NORMAL)
+		}
+	}
+	before.ParseResults()
+	after.ParseResults()
+	logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleStats), logthis.NORMAL)
+	logthis.Info(fmt.Sprintf(StatsComparison, "OK", before.Passed, after.Passed, after.Passed-before.Passed), logthis.NORMAL)
+	logthis.Info(fmt.Sprintf(StatsComparison, "KO", before.Errors, after.Errors, after.Errors-before.Errors), logthis.NORMAL)
+	logthis.Info(fmt.Sprintf(StatsComparison, "Warnings", before.Warnings, after.Warnings, after.Warnings-before.Warnings), logthis.NORMAL)
+	return len(regressed)
+}
@@ -0,0 +1,47 @@
+package propolis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentifyChecks(t *testing.T) {
+	fmt.Println("+ Testing identifyChecks...")
+	check := assert.New(t)
+
+	run := func(checks ...*Check) []string {
+		identifyChecks(checks)
+		var ids []string
+		for _, c := range checks {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+	first := run(
+		NewCheck("2.3.1", LevelCritical, "Release has 12 tracks.", "No tracks."),
+		NewCheck("2.3.1", LevelCritical, "Release has 12 tracks.", "No tracks."),
+		NewCheck(internalRule, LevelWarning, "Total size: 312.5MB.", ""),
+		NewCheck("2.3.2", LevelCritical, "Release has 12 tracks.", "No tracks."),
+		NewCheck("", LevelInfo, "", ""),
+	)
+	// numbers do not change the IDs, the rule and the order of identical checks do
+	second := run(
+		NewCheck("2.3.1", LevelCritical, "Release has 9 tracks.", "No tracks."),
+		NewCheck("2.3.1", LevelWarning, "Release has 10 tracks.", "No tracks."),
+		NewCheck(internalRule, LevelWarning, "Total size: 1024.0MB.", ""),
+		NewCheck("2.3.2", LevelCritical, "Release has 9 tracks.", "No tracks."),
+		NewCheck("", LevelInfo, "", ""),
+	)
+	check.Equal(first, second)
+	check.Regexp(`^[0-9a-f]{8}-1$`, first[0])
+	check.Equal(first[0][:8]+"-2", first[1])
+	check.NotEqual(first[0][:8], first[2][:8])
+	check.NotEqual(first[0][:8], first[3][:8])
+	check.Equal("", first[4])
+
+	// other conditions
+	other := run(NewCheck("2.3.1", LevelCritical, "Release has 12 tracks.", "Missing tracks."))
+	check.NotEqual(first[0], other[0])
+}
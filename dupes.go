@@ -0,0 +1,163 @@
+package propolis
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	trackerTimeout = 30 * time.Second
+)
+
+type trackerTorrent struct {
+	TorrentID     int    `json:"torrentId"`
+	Media         string `json:"media"`
+	Format        string `json:"format"`
+	Encoding      string `json:"encoding"`
+	RemasterYear  int    `json:"remasterYear"`
+	RemasterTitle string `json:"remasterTitle"`
+	HasLog        bool   `json:"hasLog"`
+	LogScore      int    `json:"logScore"`
+}
+
+func (t trackerTorrent) String() string {
+	description := fmt.Sprintf("#%d %s / %s / %s", t.TorrentID, t.Media, t.Format, t.Encoding)
+	if t.RemasterYear != 0 {
+		description += fmt.Sprintf(" / %d", t.RemasterYear)
+	}
+	if t.RemasterTitle != "" {
+		description += " " + html.UnescapeString(t.RemasterTitle)
+	}
+	if t.HasLog {
+		description += fmt.Sprintf(" / log %d%%", t.LogScore)
+	}
+	return description
+}
+
+type trackerGroup struct {
+	GroupID   int              `json:"groupId"`
+	GroupName string           `json:"groupName"`
+	Artist    string           `json:"artist"`
+	GroupYear int              `json:"groupYear"`
+	Torrents  []trackerTorrent `json:"torrents"`
+}
+
+type trackerBrowseResponse struct {
+	Status   string `json:"status"`
+	Error    string `json:"error"`
+	Response struct {
+		Results []trackerGroup `json:"results"`
+	} `json:"response"`
+}
+
+// searchTracker using the browse action of a Gazelle JSON API.
+// The year is not part of the search, since it would exclude the other editions of the release group.
+func searchTracker(trackerURL, apiKey, artist, album string) ([]trackerGroup, error) {
+	query := url.Values{}
+	query.Set("action", "browse")
+	query.Set("artistname", artist)
+	query.Set("groupname", album)
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(trackerURL, "/")+"/ajax.php?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", apiKey)
+	}
+	client := &http.Client{Timeout: trackerTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("tracker returned " + resp.Status)
+	}
+	var browse trackerBrowseResponse
+	if err := json.NewDecoder(resp.Body).Decode(&browse); err != nil {
+		return nil, errors.Wrap(err, "could not read tracker response")
+	}
+	if browse.Status != "success" {
+		return nil, errors.New("tracker error: " + browse.Error)
+	}
+	return browse.Response.Results, nil
+}
+
+// findDupes among the torrents of the same release on the tracker: torrents with the same media and encoding are
+// dupes, unless they are from a different edition; CD dupes with worse logs can be trumped instead, by a release with a
+// log. logScore is -1 for releases without logs.
+func findDupes(groups []trackerGroup, album string, year int, media, encoding string, logScore int) ([]string, []string, []string) {
+	var existing, dupes, trumpable []string
+	for _, g := range groups {
+		if !sameTitle(html.UnescapeString(g.GroupName), album) {
+			continue
+		}
+		for _, t := range g.Torrents {
+			description := html.UnescapeString(g.Artist+" - "+g.GroupName) + ": " + t.String()
+			existing = append(existing, description)
+			if t.Media != media || t.Format != "FLAC" || t.Encoding != encoding {
+				continue
+			}
+			// torrents without remaster information are from the original edition
+			edition := t.RemasterYear
+			if edition == 0 {
+				edition = g.GroupYear
+			}
+			if year != 0 && edition != 0 && edition != year {
+				continue
+			}
+			if media == sourceCD && logScore != -1 && t.HasLog && logScore > t.LogScore {
+				trumpable = append(trumpable, description)
+			} else {
+				dupes = append(dupes, description)
+			}
+		}
+	}
+	return existing, dupes, trumpable
+}
+
+// CheckDupes on a Gazelle tracker, before uploading.
+func (p *Propolis) CheckDupes(trackerURL, apiKey string) {
+	tags := p.release.Flacs[0].CommonTags()
+	artist := strings.Join(tags.AlbumArtist, ", ")
+	if artist == "" && len(tags.Artist) != 0 {
+		artist = tags.Artist[0]
+	}
+	year := tags.Year
+	if year == "" && len(tags.Date) >= 4 {
+		year = tags.Date[:4]
+	}
+	groups, err := searchTracker(trackerURL, apiKey, artist, tags.Album)
+	p.ErrorCheck(LevelInfo, internalRule, OKTrackerSearch, KOTrackerSearch, err, AppendError)
+	if err != nil {
+		return
+	}
+
+	encoding := encodingLossless
+	if p.release.Has24bitTracks() {
+		encoding = encoding24bitLossless
+	}
+	// the lowest log score of the release, -1 if it has none
+	logScore := -1
+	for _, r := range ripFiles(p.release.Path) {
+		if l, err := readRipLog(r); err == nil && l.ripper != ripperUnknown && (logScore == -1 || l.score < logScore) {
+			logScore = l.score
+		}
+	}
+	releaseYear, _ := strconv.Atoi(year)
+	existing, dupes, trumpable := findDupes(groups, tags.Album, releaseYear, p.source(), encoding, logScore)
+	p.ConditionCheck(LevelInfo, internalRule, fmt.Sprintf(OKTrackerExisting, len(existing)), BlankBecauseImpossible, true)
+	for _, e := range existing {
+		p.ConditionCheck(LevelInfo, internalRule, ArrowHeader+e, BlankBecauseImpossible, true)
+	}
+	p.ListCheck(LevelCritical, internalRule, OKTrackerDupes, KOTrackerDupes, dupes)
+	p.ListCheck(LevelInfo, internalRule, OKTrackerTrumpable, KOTrackerTrumpable, trumpable)
+}
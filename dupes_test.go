@@ -0,0 +1,130 @@
+package propolis
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const trackerBrowseJSON = `{
+	"status": "success",
+	"response": {
+		"results": [
+			{
+				"groupId": 1,
+				"groupName": "Album &amp; More",
+				"artist": "Artist",
+				"groupYear": 2010,
+				"torrents": [
+					{"torrentId": 10, "media": "CD", "format": "FLAC", "encoding": "Lossless", "hasLog": true, "logScore": 80},
+					{"torrentId": 11, "media": "CD", "format": "FLAC", "encoding": "Lossless", "remasterYear": 2015, "remasterTitle": "Remaster", "hasLog": true, "logScore": 100},
+					{"torrentId": 12, "media": "WEB", "format": "FLAC", "encoding": "24bit Lossless"},
+					{"torrentId": 13, "media": "CD", "format": "MP3", "encoding": "320"}
+				]
+			},
+			{
+				"groupId": 2,
+				"groupName": "Another Album",
+				"artist": "Artist",
+				"groupYear": 2010,
+				"torrents": [
+					{"torrentId": 20, "media": "CD", "format": "FLAC", "encoding": "Lossless", "hasLog": true, "logScore": 50}
+				]
+			}
+		]
+	}
+}`
+
+func TestSearchTracker(t *testing.T) {
+	fmt.Println("+ Testing searchTracker...")
+	check := assert.New(t)
+
+	var query map[string][]string
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ajax.php" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.Query()
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprint(w, trackerBrowseJSON)
+	}))
+	defer server.Close()
+
+	groups, err := searchTracker(server.URL+"/", "key", "Artist", "Album & More")
+	check.Nil(err)
+	check.Equal("key", authorization)
+	check.Equal([]string{"browse"}, query["action"])
+	check.Equal([]string{"Artist"}, query["artistname"])
+	check.Equal([]string{"Album & More"}, query["groupname"])
+	check.NotContains(query, "year")
+	check.Equal(2, len(groups))
+	check.Equal(4, len(groups[0].Torrents))
+	check.Equal(2015, groups[0].Torrents[1].RemasterYear)
+
+	// tracker errors
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "failure", "error": "bad parameters"}`)
+	}))
+	defer failing.Close()
+	_, err = searchTracker(failing.URL, "", "Artist", "Album")
+	check.EqualError(err, "tracker error: bad parameters")
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	_, err = searchTracker(broken.URL, "", "Artist", "Album")
+	check.NotNil(err)
+}
+
+func TestFindDupes(t *testing.T) {
+	fmt.Println("+ Testing findDupes...")
+	check := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, trackerBrowseJSON)
+	}))
+	defer server.Close()
+	groups, err := searchTracker(server.URL, "", "Artist", "Album & More")
+	check.Nil(err)
+
+	cases := []struct {
+		name      string
+		year      int
+		media     string
+		encoding  string
+		logScore  int
+		dupes     []int
+		trumpable []int
+	}{
+		{"original CD without log", 2010, sourceCD, encodingLossless, -1, []int{10}, nil},
+		{"original CD with a better log", 2010, sourceCD, encodingLossless, 100, nil, []int{10}},
+		{"original CD with a worse log", 2010, sourceCD, encodingLossless, 50, []int{10}, nil},
+		{"remastered CD with a perfect log", 2015, sourceCD, encodingLossless, 100, []int{11}, nil},
+		{"unknown edition", 0, sourceCD, encodingLossless, -1, []int{10, 11}, nil},
+		{"other edition", 2020, sourceCD, encodingLossless, 100, nil, nil},
+		{"hi-res WEB", 2010, sourceWEB, encoding24bitLossless, -1, []int{12}, nil},
+		{"WEB", 2010, sourceWEB, encodingLossless, -1, nil, nil},
+	}
+	for _, c := range cases {
+		existing, dupes, trumpable := findDupes(groups, "Album & More", c.year, c.media, c.encoding, c.logScore)
+		check.Equal(4, len(existing), c.name)
+		check.Equal(len(c.dupes), len(dupes), c.name)
+		for i, id := range c.dupes {
+			if i < len(dupes) {
+				check.Contains(dupes[i], fmt.Sprintf("#%d ", id), c.name)
+			}
+		}
+		check.Equal(len(c.trumpable), len(trumpable), c.name)
+		for i, id := range c.trumpable {
+			if i < len(trumpable) {
+				check.Contains(trumpable[i], fmt.Sprintf("#%d ", id), c.name)
+			}
+		}
+	}
+}
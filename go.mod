@@ -3,30 +3,33 @@ module gitlab.com/passelecasque/propolis
 go 1.18
 
 require (
+	github.com/bogem/id3v2 v1.1.1
+	github.com/disintegration/imaging v1.6.2
 	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+	github.com/go-flac/flacpicture v0.2.0
+	github.com/go-flac/go-flac v0.3.1
+	github.com/mewkiz/flac v1.0.6
 	github.com/pkg/errors v0.9.1
+	github.com/stretchr/testify v1.6.1
 	gitlab.com/catastrophic/assistance v0.44.2
+	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
+	golang.org/x/sys v0.0.0-20191120155948-bd437916bb0e
+	golang.org/x/text v0.3.2
 )
 
 require (
-	github.com/bogem/id3v2 v1.1.1 // indirect
-	github.com/disintegration/imaging v1.6.2 // indirect
-	github.com/go-flac/flacpicture v0.2.0 // indirect
-	github.com/go-flac/go-flac v0.3.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/google/go-cmp v0.3.1 // indirect
 	github.com/icza/bitio v1.0.0 // indirect
 	github.com/mattn/go-colorable v0.1.4 // indirect
 	github.com/mattn/go-isatty v0.0.8 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
-	github.com/mewkiz/flac v1.0.6 // indirect
 	github.com/mewkiz/pkg v0.0.0-20190919212034-518ade7978e2 // indirect
 	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b // indirect
 	github.com/mozillazg/go-unidecode v0.1.1 // indirect
 	github.com/nsf/termbox-go v0.0.0-20190104133558-0938b5187e61 // indirect
-	github.com/stretchr/testify v1.6.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/tj/go-spin v1.1.0 // indirect
 	gitlab.com/catastrophic/gotabulate v0.0.0-20190228104527-d3d77fbbb3a1 // indirect
-	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8 // indirect
-	golang.org/x/sys v0.0.0-20191120155948-bd437916bb0e // indirect
-	golang.org/x/text v0.3.2 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -0,0 +1,160 @@
+package propolis
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/catastrophic/assistance/flac"
+)
+
+const (
+	testSampleRate = 44100
+	testBlockSize  = 4096
+)
+
+// bitWriter packs values of any width, most significant bit first.
+type bitWriter struct {
+	data  []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(value uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.acc = w.acc<<1 | (value>>uint(i))&1
+		w.nbits++
+		if w.nbits == 8 {
+			w.data = append(w.data, byte(w.acc))
+			w.acc, w.nbits = 0, 0
+		}
+	}
+}
+
+func flacCRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// writeTestFlac with 16bit/44.1kHz verbatim (uncompressed) subframes, and tags given as "FIELD=value".
+// sample returns the value of a sample of a channel.
+func writeTestFlac(t *testing.T, path string, channels, samples int, sample func(channel, i int) int32, tags ...string) *flac.Flac {
+	md5sum := md5.New()
+	var frames []byte
+	for number, start := 0, 0; start < samples; number, start = number+1, start+testBlockSize {
+		size := testBlockSize
+		if samples-start < size {
+			size = samples - start
+		}
+		w := &bitWriter{}
+		// sync code, fixed block size, 16bit block size at the end of the header, 44.1kHz, channels, 16bit
+		w.write(0x3FFE, 14)
+		w.write(0, 2)
+		w.write(7, 4)
+		w.write(9, 4)
+		w.write(uint64(channels-1), 4)
+		w.write(4, 3)
+		w.write(0, 1)
+		if number >= 0x80 {
+			t.Fatal("too many frames for a test track")
+		}
+		w.write(uint64(number), 8)
+		w.write(uint64(size-1), 16)
+		w.data = append(w.data, flacCRC8(w.data))
+		for c := 0; c < channels; c++ {
+			// verbatim subframe header
+			w.write(0, 1)
+			w.write(1, 6)
+			w.write(0, 1)
+			for i := start; i < start+size; i++ {
+				w.write(uint64(uint16(sample(c, i))), 16)
+			}
+		}
+		for w.nbits != 0 {
+			w.write(0, 1)
+		}
+		crc := flacCRC16(w.data)
+		frames = append(frames, append(w.data, byte(crc>>8), byte(crc))...)
+		for i := start; i < start+size; i++ {
+			for c := 0; c < channels; c++ {
+				s := sample(c, i)
+				md5sum.Write([]byte{byte(s), byte(s >> 8)})
+			}
+		}
+	}
+
+	info := &bitWriter{}
+	info.write(testBlockSize, 16)
+	info.write(testBlockSize, 16)
+	info.write(0, 24)
+	info.write(0, 24)
+	info.write(testSampleRate, 20)
+	info.write(uint64(channels-1), 3)
+	info.write(15, 5)
+	info.write(uint64(samples), 36)
+	info.data = append(info.data, md5sum.Sum(nil)...)
+
+	comment := &bytes.Buffer{}
+	vendor := "propolis tests"
+	binary.Write(comment, binary.LittleEndian, uint32(len(vendor)))
+	comment.WriteString(vendor)
+	binary.Write(comment, binary.LittleEndian, uint32(len(tags)))
+	for _, tag := range tags {
+		binary.Write(comment, binary.LittleEndian, uint32(len(tag)))
+		comment.WriteString(tag)
+	}
+
+	var data bytes.Buffer
+	data.WriteString("fLaC")
+	data.Write([]byte{0, 0, 0, byte(len(info.data))})
+	data.Write(info.data)
+	data.Write([]byte{0x84, byte(comment.Len() >> 16), byte(comment.Len() >> 8), byte(comment.Len())})
+	data.Write(comment.Bytes())
+	data.Write(frames)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := flac.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// noise that does not repeat, so that it does not look mono, inverted or silent.
+func noise(channel, i int) int32 {
+	return int32((i*7919+channel*104729)%20011) - 10005
+}
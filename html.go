@@ -0,0 +1,155 @@
+package propolis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/catastrophic/assistance/fs"
+)
+
+// reportSection is a group of checks, as shown in reports.
+type reportSection struct {
+	Title  string
+	Checks []*Check
+}
+
+type reportTrack struct {
+	Filename   string
+	Duration   string
+	SampleRate int
+	BitDepth   int
+	Channels   int
+	BitRate    int
+	Size       string
+	Number     string
+	Artist     string
+	Title      string
+	Album      string
+}
+
+type reportImage struct {
+	Name string
+	Data template.URL
+}
+
+type htmlReport struct {
+	Path         string
+	Version      string
+	Date         string
+	Summary      string
+	Sections     []reportSection
+	Tracks       []reportTrack
+	Spectrograms []reportImage
+}
+
+// checkClass gives checks the same colours as Check.String().
+func checkClass(c *Check) string {
+	switch c.Result {
+	case Warning:
+		return "warning"
+	case KO:
+		return "ko"
+	default:
+		return "ok"
+	}
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"class": checkClass}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>propolis: {{.Path}}</title>
+<style>
+body { font-family: sans-serif; background: #1e1e1e; color: #ddd; margin: 2em; }
+h1 { color: #ffd75f; font-size: 1.4em; }
+h2 { color: #5fafff; font-size: 1.1em; text-decoration: underline; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { padding: 0.2em 0.6em; text-align: left; border-bottom: 1px solid #333; }
+.rule { color: #999; font-family: monospace; }
+.ok { color: #5fafff; font-weight: bold; }
+.warning { color: #ffd75f; font-weight: bold; }
+.ko { color: #ff5f5f; font-weight: bold; }
+img { max-width: 100%; display: block; margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<p>Generated by propolis {{.Version}} on {{.Date}}. <span class="ok">{{.Summary}}</span></p>
+{{range .Sections}}<h2>{{.Title}}</h2>
+<table>
+{{range .Checks}}<tr class="{{class .}}"><td>{{.Bullet}}</td><td class="rule">{{.Rule}}</td><td>{{.ResultComment}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Tracks}}<h2>Tracks</h2>
+<table>
+<tr><th>#</th><th>File</th><th>Duration</th><th>Sample rate</th><th>Bit depth</th><th>Channels</th><th>Bit rate</th><th>Size</th><th>Artist</th><th>Title</th><th>Album</th></tr>
+{{range .Tracks}}<tr><td>{{.Number}}</td><td>{{.Filename}}</td><td>{{.Duration}}</td><td>{{.SampleRate}}Hz</td><td>{{.BitDepth}}bit</td><td>{{.Channels}}</td><td>{{.BitRate}}kbps</td><td>{{.Size}}</td><td>{{.Artist}}</td><td>{{.Title}}</td><td>{{.Album}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Spectrograms}}<h2>Spectrograms</h2>
+{{range .Spectrograms}}<p>{{.Name}}</p>
+<img src="{{.Data}}" alt="{{.Name}}">
+{{end}}{{end}}</body>
+</html>
+`))
+
+// SaveHTML report in dir, with checks grouped as they were run, the tracks and the spectrograms found in dir.
+// The overview, if any, is shown first.
+func (p *Propolis) SaveHTML(dir, overviewFile, version string) (string, error) {
+	report := htmlReport{Path: p.Path, Version: version, Date: time.Now().Format("2006-01-02 15:04"), Summary: p.Summary(), Sections: p.sections}
+	if len(report.Sections) == 0 {
+		report.Sections = []reportSection{{Title: "Checks", Checks: p.Checks}}
+	}
+	for _, f := range p.release.Flacs {
+		tags := f.CommonTags()
+		report.Tracks = append(report.Tracks, reportTrack{
+			Filename:   filepath.Base(f.Path),
+			Duration:   fmt.Sprintf("%d:%02d", int(f.DurationSeconds)/60, int(f.DurationSeconds)%60),
+			SampleRate: f.SampleRate,
+			BitDepth:   f.BitDepth,
+			Channels:   f.ChannelCount,
+			BitRate:    f.AverageBitRate / 1000,
+			Size:       fmt.Sprintf("%.2fMb", float64(f.Size)/Size1024KiB),
+			Number:     tags.TrackNumber,
+			Artist:     strings.Join(tags.Artist, ", "),
+			Title:      tags.Title,
+			Album:      tags.Album,
+		})
+	}
+
+	images := listSpectrograms(dir)
+	if overviewFile != "" {
+		overview := filepath.Base(overviewFile)
+		ordered := []string{overview}
+		for _, i := range images {
+			if i != overview {
+				ordered = append(ordered, i)
+			}
+		}
+		images = ordered
+	}
+	for _, i := range images {
+		if !fs.FileExists(filepath.Join(dir, i)) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, i))
+		if err != nil {
+			return "", err
+		}
+		report.Spectrograms = append(report.Spectrograms, reportImage{Name: i, Data: template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(data))})
+	}
+
+	var buffer bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buffer, report); err != nil {
+		return "", err
+	}
+	outputFile := filepath.Join(dir, "propolis.html")
+	if version != "" {
+		outputFile = filepath.Join(dir, fmt.Sprintf("propolis_%s.html", version))
+	}
+	return outputFile, ioutil.WriteFile(outputFile, buffer.Bytes(), 0600)
+}
@@ -0,0 +1,78 @@
+package propolis
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/music"
+)
+
+func TestSaveHTML(t *testing.T) {
+	fmt.Println("+ Testing SaveHTML...")
+	check := assert.New(t)
+
+	root := t.TempDir()
+	metadataDir := t.TempDir()
+	track := writeTestFlac(t, filepath.Join(root, "01 - Song.flac"), 2, testSampleRate, noise, "TRACKNUMBER=1", "ARTIST=Artist & Co", "TITLE=Song", "ALBUM=Album")
+	release := music.New(root)
+	release.Flacs = []*flac.Flac{track}
+
+	p := NewPropolis(root, release, false)
+	p.ToggleStdOutput(false)
+	p.ConditionCheck(LevelCritical, "<first rule>", "first ok", "first ko", true)
+	p.ConditionCheck(LevelCritical, "second rule", "second ok", "second ko", false)
+	p.ConditionCheck(LevelWarning, "third rule", "third ok", "third ko", false)
+
+	spectrograms := map[string][]byte{"full.png": []byte("full"), "1.png": []byte("first"), "overview.png": []byte("overview")}
+	for name, data := range spectrograms {
+		check.Nil(ioutil.WriteFile(filepath.Join(metadataDir, name), data, 0600))
+	}
+	check.Nil(ioutil.WriteFile(filepath.Join(metadataDir, "notes.txt"), []byte("not an image"), 0600))
+
+	// without sections, all checks are shown together
+	output, err := p.SaveHTML(metadataDir, filepath.Join(metadataDir, "overview.png"), "v1")
+	check.Nil(err)
+	check.Equal(filepath.Join(metadataDir, "propolis_v1.html"), output)
+	content, err := ioutil.ReadFile(output)
+	check.Nil(err)
+	html := string(content)
+
+	check.Contains(html, "<title>propolis: "+root+"</title>")
+	check.Contains(html, "Generated by propolis v1")
+	check.Contains(html, "1 checks OK, 1 checks KO, and 1 warnings.")
+	check.Contains(html, "<h2>Checks</h2>")
+	check.Contains(html, `class="rule">&lt;first rule&gt;</td><td>first ok</td>`)
+	check.Contains(html, `<tr class="ko">`)
+	check.Contains(html, `<tr class="warning">`)
+	check.Contains(html, "<td>01 - Song.flac</td><td>0:01</td><td>44100Hz</td><td>16bit</td><td>2</td>")
+	check.Contains(html, "<td>Artist &amp; Co</td><td>Song</td><td>Album</td>")
+	check.NotContains(html, "notes.txt")
+
+	// the overview comes first, then the other spectrograms
+	var positions []int
+	for _, name := range []string{"overview.png", "1.png", "full.png"} {
+		data := "data:image/png;base64," + base64.StdEncoding.EncodeToString(spectrograms[name])
+		check.Contains(html, `<img src="`+data+`" alt="`+name+`">`)
+		positions = append(positions, strings.Index(html, data))
+	}
+	check.True(positions[0] < positions[1] && positions[1] < positions[2])
+
+	// with sections, checks are grouped
+	p.sections = []reportSection{{Title: "Tags", Checks: p.Checks[:1]}, {Title: "Music", Checks: p.Checks[1:]}}
+	output, err = p.SaveHTML(metadataDir, "", "")
+	check.Nil(err)
+	check.Equal(filepath.Join(metadataDir, "propolis.html"), output)
+	content, err = ioutil.ReadFile(output)
+	check.Nil(err)
+	html = string(content)
+	check.NotContains(html, "<h2>Checks</h2>")
+	check.True(strings.Index(html, "<h2>Tags</h2>") < strings.Index(html, "&lt;first rule&gt;"))
+	check.True(strings.Index(html, "<h2>Music</h2>") < strings.Index(html, "second rule"))
+	check.True(strings.Index(html, "&lt;first rule&gt;") < strings.Index(html, "<h2>Music</h2>"))
+}
@@ -0,0 +1,189 @@
+package propolis
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	mflac "github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"gitlab.com/catastrophic/assistance/flac"
+)
+
+// uncompressedRatio is the proportion of verbatim subframes above which a track is considered uncompressed.
+const uncompressedRatio = 0.9
+
+// trackIntegrity is the result of decoding a whole track.
+type trackIntegrity struct {
+	track string
+	// STREAMINFO MD5 and total samples, as declared
+	md5             string
+	md5Unset        bool
+	expectedSamples uint64
+	// results from decoding
+	decodedMD5     string
+	decodedSamples uint64
+	decodedFrames  int
+	decodeErr      error
+	truncated      bool
+	// errorOffset is the position in the file of the frame that could not be decoded
+	errorOffset int64
+	// subframes stored without any prediction
+	subframes         int
+	verbatimSubframes int
+	// comparison of the left and right channels of stereo tracks
+	channels channelStats
+	// result of the test by the flac binary
+	flacErr error
+}
+
+// Problems found while decoding the track, the MD5 signature being unset is reported separately.
+func (t *trackIntegrity) Problems() []string {
+	var problems []string
+	// the flac binary also complains about unset MD5 signatures, which are reported separately
+	if t.flacErr != nil && !(t.md5Unset && t.decodeErr == nil) {
+		problems = append(problems, fmt.Sprintf("%s: flac test failed: %s", t.track, t.flacErr.Error()))
+	}
+	switch {
+	case t.truncated:
+		problems = append(problems, fmt.Sprintf("%s: truncated final frame, at byte %d", t.track, t.errorOffset))
+	case t.decodeErr != nil:
+		problems = append(problems, fmt.Sprintf("%s: decoding error in the frame at byte %d: %s", t.track, t.errorOffset, t.decodeErr.Error()))
+	}
+	if t.decodeErr == nil && t.expectedSamples != 0 && t.expectedSamples != t.decodedSamples {
+		problems = append(problems, fmt.Sprintf("%s: STREAMINFO declares %d samples, %d were decoded", t.track, t.expectedSamples, t.decodedSamples))
+	}
+	if !t.md5Unset && t.decodeErr == nil && t.md5 != t.decodedMD5 {
+		problems = append(problems, fmt.Sprintf("%s: MD5 signature mismatch, STREAMINFO has %s, decoded audio has %s", t.track, t.md5, t.decodedMD5))
+	}
+	return problems
+}
+
+// CheckCompression returns an error if most subframes are stored verbatim.
+func (t *trackIntegrity) CheckCompression() error {
+	if t.subframes == 0 {
+		return errors.New(t.track + ": no audio could be decoded")
+	}
+	ratio := float64(t.verbatimSubframes) / float64(t.subframes)
+	if ratio >= uncompressedRatio {
+		return fmt.Errorf("%s: %w: %.0f%% of subframes are stored verbatim", t.track, flac.ErrorUncompressed, 100*ratio)
+	}
+	return nil
+}
+
+// flacBinaryAvailable returns true if the flac binary can be used to test tracks.
+func flacBinaryAvailable() bool {
+	_, err := exec.LookPath("flac")
+	return err == nil
+}
+
+// checkIntegrity of all tracks, jobs at a time; results are in the same order as the tracks.
+// Tracks are always decoded, since the compression and channel checks need the decoded subframes. If the flac binary
+// is installed, tracks are also tested with it, as an extra check.
+// Unchanged tracks are not decoded again if their results were cached.
+func checkIntegrity(flacs []*flac.Flac, jobs int, cache *analysisCache) []*trackIntegrity {
+	useBinary := flacBinaryAvailable()
+	results := make([]*trackIntegrity, len(flacs))
+	runInParallel(jobs, len(flacs), func(i int) {
+		f := flacs[i]
+		if cached := cache.get(f); cached != nil && cached.Decoded && cached.ChannelsCompared && (cached.FlacTested || !useBinary) {
+			results[i] = cached.integrity(filepath.Base(f.Path))
+			return
+		}
+		results[i] = decodeTrack(f.Path)
+		if useBinary {
+			results[i].flacErr = f.Check()
+		}
+		cache.update(f, func(t *cachedTrack) {
+			t.setIntegrity(results[i])
+			t.FlacTested = useBinary
+		})
+	})
+	return results
+}
+
+// countingReader keeps track of how many bytes were read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodeTrack entirely, comparing what was decoded with the STREAMINFO block.
+func decodeTrack(path string) *trackIntegrity {
+	t := &trackIntegrity{track: filepath.Base(path)}
+	file, err := os.Open(path)
+	if err != nil {
+		t.decodeErr = err
+		return t
+	}
+	defer file.Close()
+	// mflac.New keeps using a *bufio.Reader instead of wrapping it in another one, so the position of each frame in
+	// the file is what was read minus what is still buffered.
+	read := &countingReader{r: file}
+	buffered := bufio.NewReader(read)
+	stream, err := mflac.New(buffered)
+	if err != nil {
+		t.decodeErr = err
+		return t
+	}
+
+	t.md5 = hex.EncodeToString(stream.Info.MD5sum[:])
+	t.md5Unset = bytes.Equal(stream.Info.MD5sum[:], make([]byte, md5.Size))
+	t.expectedSamples = stream.Info.NSamples
+
+	md5sum := md5.New()
+	for {
+		offset := read.n - int64(buffered.Buffered())
+		fr, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.decodeErr = err
+			t.errorOffset = offset
+			t.truncated = errors.Is(err, io.ErrUnexpectedEOF)
+			break
+		}
+		hashSamples(md5sum, fr)
+		t.channels.add(fr)
+		for _, subframe := range fr.Subframes {
+			t.subframes++
+			if subframe.Pred == frame.PredVerbatim {
+				t.verbatimSubframes++
+			}
+		}
+		t.decodedSamples += uint64(fr.BlockSize)
+		t.decodedFrames++
+	}
+	t.decodedMD5 = hex.EncodeToString(md5sum.Sum(nil))
+	return t
+}
+
+// hashSamples the same way the flac encoder does: interleaved, little-endian, using the smallest number of bytes per sample.
+func hashSamples(md5sum hash.Hash, fr *frame.Frame) {
+	bytesPerSample := (int(fr.BitsPerSample) + 7) / 8
+	buf := make([]byte, 0, int(fr.BlockSize)*len(fr.Subframes)*bytesPerSample)
+	for i := 0; i < int(fr.BlockSize); i++ {
+		for _, subframe := range fr.Subframes {
+			sample := subframe.Samples[i]
+			for b := 0; b < bytesPerSample; b++ {
+				buf = append(buf, uint8(sample>>(8*b)))
+			}
+		}
+	}
+	md5sum.Write(buf)
+}
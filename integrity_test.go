@@ -0,0 +1,138 @@
+package propolis
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/flac"
+)
+
+func TestCompressionParity(t *testing.T) {
+	fmt.Println("+ Testing CheckCompression...")
+	check := assert.New(t)
+
+	tracks, err := filepath.Glob(filepath.Join("testdata", "*.flac"))
+	check.Nil(err)
+	check.NotEmpty(tracks)
+	uncompressed := filepath.Join(t.TempDir(), "uncompressed.flac")
+	writeTestFlac(t, uncompressed, 2, 3*testBlockSize+100, noise)
+	tracks = append(tracks, uncompressed)
+
+	// the decoded subframes must give the same result as comparing the file size with the size of the raw audio
+	for _, track := range tracks {
+		f, err := flac.New(track)
+		check.Nil(err)
+		integrity := decodeTrack(track)
+		check.Empty(integrity.Problems(), track)
+		sizeErr, subframesErr := f.CheckCompression(), integrity.CheckCompression()
+		check.Equal(sizeErr == nil, subframesErr == nil, track)
+		if track == uncompressed {
+			check.True(errors.Is(subframesErr, flac.ErrorUncompressed))
+			check.Contains(subframesErr.Error(), "uncompressed.flac: ")
+		}
+	}
+
+	// tracks that could not be decoded at all cannot be checked
+	empty := &trackIntegrity{track: "empty.flac"}
+	check.EqualError(empty.CheckCompression(), "empty.flac: no audio could be decoded")
+}
+
+func TestDecodeTrack(t *testing.T) {
+	fmt.Println("+ Testing decodeTrack...")
+	check := assert.New(t)
+
+	// mono, 16bit verbatim frames: 8 bytes of header, 1 byte of subframe header, the samples, and the CRC-16
+	const (
+		samples        = 2*testBlockSize + 100
+		fullFrameSize  = 8 + 1 + 2*testBlockSize + 2
+		finalFrameSize = 8 + 1 + 2*100 + 2
+		// STREAMINFO starts after the signature and the block header
+		totalSamplesByte = 4 + 4 + 13
+		md5Byte          = 4 + 4 + 18
+	)
+	dir := t.TempDir()
+	write := func(name string, edit func(data []byte) []byte) string {
+		path := filepath.Join(dir, name)
+		writeTestFlac(t, path, 1, samples, noise)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, edit(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	valid := write("valid.flac", func(data []byte) []byte { return data })
+	integrity := decodeTrack(valid)
+	check.Nil(integrity.decodeErr)
+	check.Empty(integrity.Problems())
+	check.Equal(uint64(samples), integrity.decodedSamples)
+	check.Equal(3, integrity.decodedFrames)
+	check.False(integrity.md5Unset)
+	check.Equal(integrity.md5, integrity.decodedMD5)
+	validMD5 := integrity.md5
+	info, err := os.Stat(valid)
+	check.Nil(err)
+	audioOffset := info.Size() - 2*fullFrameSize - finalFrameSize
+
+	// MD5 mismatch
+	path := write("md5.flac", func(data []byte) []byte {
+		data[md5Byte] ^= 0xFF
+		return data
+	})
+	integrity = decodeTrack(path)
+	declared, err := hex.DecodeString(validMD5)
+	check.Nil(err)
+	declared[0] ^= 0xFF
+	check.Equal([]string{fmt.Sprintf("md5.flac: MD5 signature mismatch, STREAMINFO has %s, decoded audio has %s", hex.EncodeToString(declared), validMD5)}, integrity.Problems())
+
+	// unset MD5, reported separately
+	path = write("unset.flac", func(data []byte) []byte {
+		copy(data[md5Byte:md5Byte+16], make([]byte, 16))
+		return data
+	})
+	integrity = decodeTrack(path)
+	check.True(integrity.md5Unset)
+	check.Empty(integrity.Problems())
+
+	// sample count mismatch, the last 32 of the 36 bits of the total number of samples are byte-aligned
+	path = write("samples.flac", func(data []byte) []byte {
+		data[totalSamplesByte+4]++
+		return data
+	})
+	integrity = decodeTrack(path)
+	check.Equal([]string{fmt.Sprintf("samples.flac: STREAMINFO declares %d samples, %d were decoded", samples+1, samples)}, integrity.Problems())
+
+	// truncated final frame
+	path = write("truncated.flac", func(data []byte) []byte { return data[:len(data)-10] })
+	integrity = decodeTrack(path)
+	check.True(integrity.truncated)
+	check.Equal(audioOffset+2*fullFrameSize, integrity.errorOffset)
+	check.Equal([]string{fmt.Sprintf("truncated.flac: truncated final frame, at byte %d", audioOffset+2*fullFrameSize)}, integrity.Problems())
+
+	// corrupted frame header
+	path = write("corrupted.flac", func(data []byte) []byte {
+		data[audioOffset+fullFrameSize+4]++
+		return data
+	})
+	integrity = decodeTrack(path)
+	check.False(integrity.truncated)
+	check.Equal(audioOffset+fullFrameSize, integrity.errorOffset)
+	problems := integrity.Problems()
+	if check.Equal(1, len(problems)) {
+		check.Contains(problems[0], fmt.Sprintf("corrupted.flac: decoding error in the frame at byte %d: ", audioOffset+fullFrameSize))
+	}
+
+	// the offset is kept in the cache
+	cached := &cachedTrack{}
+	cached.setIntegrity(integrity)
+	check.Equal(problems, cached.integrity("corrupted.flac").Problems())
+}
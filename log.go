@@ -14,6 +14,20 @@ const (
 
 type Result int
 
+// bullet displayed for a result.
+func (r Result) bullet() string {
+	switch r {
+	case OK:
+		return OKString
+	case Warning:
+		return WarningString
+	case KO:
+		return KOString
+	default:
+		return NeutralString
+	}
+}
+
 type Log struct {
 	logthis.LogThis
 	problemsOnly bool
@@ -0,0 +1,139 @@
+package propolis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	manifestName = "propolis"
+)
+
+// manifestEntry describes a file of the release, with its path relative to the release root.
+type manifestEntry struct {
+	path        string
+	size        int64
+	md5         string
+	crc32       string
+	fingerprint string
+}
+
+// getReleaseFiles, relative to the release root and sorted.
+func getReleaseFiles(root string, snatched bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if snatched {
+		files = IgnoreVarroaFiles(files)
+	}
+	sort.Strings(files)
+	return files, err
+}
+
+func buildManifest(root string, snatched bool) ([]*manifestEntry, error) {
+	files, err := getReleaseFiles(root, snatched)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*manifestEntry
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		e := &manifestEntry{path: filepath.ToSlash(f), size: info.Size()}
+		if e.md5, err = fs.CalculateMD5(path); err != nil {
+			return nil, err
+		}
+		if e.crc32, err = calculateCRC32(path); err != nil {
+			return nil, err
+		}
+		if strings.ToLower(filepath.Ext(path)) == ".flac" {
+			if e.fingerprint, err = streamInfoMD5(path); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// SaveManifest of the release in dir, as .md5, .sfv and .ffp files.
+func (p *Propolis) SaveManifest(dir string, snatched bool, version string) error {
+	entries, err := buildManifest(p.release.Path, snatched)
+	if err != nil {
+		return errors.Wrap(err, "could not build manifest")
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	header := fmt.Sprintf("; generated by propolis %s for %s\n", version, filepath.Base(p.release.Path))
+	var md5s, sfv, sfvSizes, ffp string
+	for _, e := range entries {
+		md5s += fmt.Sprintf("%s *%s\n", e.md5, e.path)
+		sfvSizes += fmt.Sprintf("; %12d %s\n", e.size, e.path)
+		sfv += fmt.Sprintf("%s %s\n", e.path, strings.ToUpper(e.crc32))
+		if e.fingerprint != "" {
+			ffp += fmt.Sprintf("%s:%s\n", e.path, e.fingerprint)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, manifestName+md5Ext), []byte(md5s), 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, manifestName+sfvExt), []byte(header+sfvSizes+sfv), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, manifestName+ffpExt), []byte(header+ffp), 0600)
+}
+
+// compareWithManifest returns the files added, removed and modified since the manifest was generated.
+func compareWithManifest(root, manifest string, snatched bool) ([]string, []string, []string, error) {
+	var added, removed, modified []string
+	c, err := parseChecksumFile(manifest)
+	if err != nil {
+		return added, removed, modified, err
+	}
+	files, err := getReleaseFiles(root, snatched)
+	if err != nil {
+		return added, removed, modified, err
+	}
+	var listed []string
+	for _, e := range c.entries {
+		listed = append(listed, e.file)
+		if !strslice.Contains(files, e.file) {
+			removed = append(removed, e.file)
+			continue
+		}
+		actual, err := fs.CalculateMD5(filepath.Join(root, e.file))
+		if err != nil {
+			return added, removed, modified, err
+		}
+		if actual != e.expected {
+			modified = append(modified, e.file)
+		}
+	}
+	for _, f := range files {
+		if !strslice.Contains(listed, f) {
+			added = append(added, f)
+		}
+	}
+	return added, removed, modified, nil
+}
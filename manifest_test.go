@@ -0,0 +1,66 @@
+package propolis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/music"
+)
+
+func TestManifest(t *testing.T) {
+	fmt.Println("+ Testing manifests...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "Artist - Album (2020) [FLAC]")
+	metadataDir := filepath.Join(dir, "metadata")
+	writeTestFlac(t, filepath.Join(root, "01 - One.flac"), 2, testBlockSize, noise, "TITLE=One")
+	writeTestFlac(t, filepath.Join(root, "CD2", "01 - Two.flac"), 2, testBlockSize, noise, "TITLE=Two")
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "info.txt"), []byte("info"), 0600))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "cover.jpg"), []byte("cover"), 0600))
+
+	p := NewPropolis(root, music.NewWithExternalMetadata(root, metadataDir), false)
+	check.Nil(p.SaveManifest(metadataDir, false, "test"))
+	for _, ext := range []string{md5Ext, sfvExt, ffpExt} {
+		// paths are relative to the release root
+		data, err := ioutil.ReadFile(filepath.Join(metadataDir, manifestName+ext))
+		check.Nil(err, ext)
+		check.Nil(ioutil.WriteFile(filepath.Join(root, manifestName+ext), data, 0600))
+		c, err := parseChecksumFile(filepath.Join(root, manifestName+ext))
+		check.Nil(err, ext)
+		mismatches, stale := c.Verify(root)
+		check.Empty(mismatches, ext)
+		check.Empty(stale, ext)
+		check.Nil(os.Remove(filepath.Join(root, manifestName+ext)))
+		if ext == ffpExt {
+			// fingerprints are only for FLAC files
+			check.Equal(2, len(c.entries))
+		} else {
+			check.Equal(4, len(c.entries), ext)
+		}
+	}
+
+	manifest := filepath.Join(metadataDir, manifestName+md5Ext)
+	added, removed, modified, err := compareWithManifest(root, manifest, false)
+	check.Nil(err)
+	check.Empty(added)
+	check.Empty(removed)
+	check.Empty(modified)
+
+	// changing the release
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "info.txt"), []byte("more info"), 0600))
+	check.Nil(os.Remove(filepath.Join(root, "cover.jpg")))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "CD2", "folder.jpg"), []byte("cover"), 0600))
+	added, removed, modified, err = compareWithManifest(root, manifest, false)
+	check.Nil(err)
+	check.Equal([]string{filepath.Join("CD2", "folder.jpg")}, added)
+	check.Equal([]string{"cover.jpg"}, removed)
+	check.Equal([]string{"info.txt"}, modified)
+
+	_, _, _, err = compareWithManifest(root, filepath.Join(metadataDir, "missing.md5"), false)
+	check.NotNil(err)
+}
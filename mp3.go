@@ -0,0 +1,533 @@
+package propolis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	mp3Ext = ".mp3"
+
+	// encodings, as in Gazelle upload forms.
+	encoding320   = "320"
+	encoding256   = "256"
+	encoding192   = "192"
+	encodingV0    = "V0 (VBR)"
+	encodingV1    = "V1 (VBR)"
+	encodingV2    = "V2 (VBR)"
+	encodingAPS   = "APS (VBR)"
+	encodingAPX   = "APX (VBR)"
+	encodingOther = "Other"
+
+	// how far the first MPEG frame can be from the end of the ID3v2 tag.
+	mp3SyncSearchSize = 64 * 1024
+)
+
+var (
+	// encodings that are not trumpable by another MP3 encoding.
+	preferredMP3Encodings = []string{encoding320, encodingV0, encodingV2}
+	// required ID3v2 frames: title, artist, album, track number.
+	requiredID3v2Frames = []string{"TIT2", "TPE1", "TALB", "TRCK"}
+	// minimum lowpass, in Hz, of LAME encodes with default settings; lower values mean the settings were changed, or
+	// that a lossy source was transcoded with a lowpass matching its own.
+	minimumLAMELowpass = map[string]int{
+		encoding320: 19500,
+		encoding256: 19000,
+		encodingV0:  19000,
+		encodingAPX: 19000,
+		encodingV1:  18500,
+		encodingV2:  18000,
+		encodingAPS: 18000,
+		encoding192: 17500,
+	}
+	// kbps, by bitrate index, for MPEG-1 and MPEG-2/2.5 layer III.
+	mpeg1Bitrates = []int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+	mpeg2Bitrates = []int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}
+	// Hz, by MPEG version and sample rate index.
+	mpegSampleRates = map[int][]int{
+		1: {44100, 48000, 32000},
+		2: {22050, 24000, 16000},
+		3: {11025, 12000, 8000}, // MPEG 2.5
+	}
+)
+
+// mp3Track holds what can be checked in an MP3: ID3v2 tags, first MPEG frame header, and Xing/LAME header.
+type mp3Track struct {
+	Path string
+	// ID3Version is the ID3v2 minor version (3 for ID3v2.3), 0 if there is no ID3v2 tag.
+	ID3Version int
+	Frames     []string
+	ID3v1      bool
+
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	TrackNumber string
+	DiscNumber  string
+	Year        string
+
+	MPEGVersion int
+	Layer       int
+	SampleRate  int
+	Channels    int
+	// Bitrate of the first frame, in kbps.
+	Bitrate         int
+	DurationSeconds float64
+	// VBR if the first frame is a Xing header, CBR encodes by LAME have an Info header instead.
+	VBR     bool
+	Quality int
+	// Encoder, LAME preset and lowpass (in Hz), if the track has a LAME header.
+	Encoder string
+	Preset  int
+	Lowpass int
+}
+
+// readMP3 tags and headers.
+func readMP3(path string) (*mp3Track, error) {
+	t := &mp3Track{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// ID3v2 tag, which the MPEG frames follow
+	var audioStart int64
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, errors.Wrap(err, "file too short")
+	}
+	if string(header[:3]) == "ID3" {
+		t.ID3Version = int(header[3])
+		audioStart = 10 + (int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f))
+		if header[5]&0x10 != 0 {
+			// footer
+			audioStart += 10
+		}
+		// ID3v2.2 tags have 3-letter frame IDs, they cannot be read and are not accepted anyway
+		if t.ID3Version >= 3 {
+			if err := t.readID3v2(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// ID3v1 tag, at the end of the file
+	id3v1 := make([]byte, 3)
+	if info.Size() >= 128 {
+		if _, err := f.ReadAt(id3v1, info.Size()-128); err == nil && string(id3v1) == "TAG" {
+			t.ID3v1 = true
+		}
+	}
+
+	// first MPEG frame
+	buffer := make([]byte, mp3SyncSearchSize)
+	n, err := f.ReadAt(buffer, audioStart)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buffer = buffer[:n]
+	offset := -1
+	for i := 0; i+4 <= len(buffer); i++ {
+		if t.readFrameHeader(buffer[i:]) {
+			offset = i
+			break
+		}
+	}
+	if offset == -1 {
+		return nil, errors.New("no MPEG frame found")
+	}
+	t.readXingHeader(buffer[offset:])
+	if t.DurationSeconds == 0 && t.Bitrate != 0 {
+		// CBR without header, estimating the duration from the size
+		t.DurationSeconds = float64(info.Size()-audioStart-int64(offset)) * 8 / float64(t.Bitrate*1000)
+	}
+	return t, nil
+}
+
+// readID3v2 frames, f being at the start of the file.
+func (t *mp3Track) readID3v2(f *os.File) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tag, err := id3v2.ParseReader(f, id3v2.Options{Parse: true})
+	if err != nil {
+		return errors.Wrap(err, "could not read ID3v2 tag")
+	}
+	for id := range tag.AllFrames() {
+		t.Frames = append(t.Frames, id)
+	}
+	sort.Strings(t.Frames)
+	t.Title, t.Artist, t.Album = tag.Title(), tag.Artist(), tag.Album()
+	t.AlbumArtist = tag.GetTextFrame("TPE2").Text
+	t.TrackNumber = tag.GetTextFrame("TRCK").Text
+	t.DiscNumber = tag.GetTextFrame("TPOS").Text
+	// TYER in ID3v2.3, TDRC in ID3v2.4
+	t.Year = tag.Year()
+	if t.Year == "" {
+		t.Year = tag.GetTextFrame("TYER").Text
+	}
+	if len(t.Year) > 4 {
+		t.Year = t.Year[:4]
+	}
+	return nil
+}
+
+// readFrameHeader at the start of data, returning false if it is not a valid layer III frame header.
+func (t *mp3Track) readFrameHeader(data []byte) bool {
+	if data[0] != 0xff || data[1]&0xe0 != 0xe0 {
+		return false
+	}
+	var version int
+	switch (data[1] >> 3) & 0x03 {
+	case 3:
+		version = 1
+	case 2:
+		version = 2
+	case 0:
+		version = 3
+	default:
+		return false
+	}
+	// only layer III
+	if (data[1]>>1)&0x03 != 1 {
+		return false
+	}
+	bitrateIndex, sampleRateIndex := int(data[2]>>4), int((data[2]>>2)&0x03)
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return false
+	}
+	t.MPEGVersion, t.Layer = version, 3
+	t.SampleRate = mpegSampleRates[version][sampleRateIndex]
+	if version == 1 {
+		t.Bitrate = mpeg1Bitrates[bitrateIndex]
+	} else {
+		t.Bitrate = mpeg2Bitrates[bitrateIndex]
+	}
+	t.Channels = 2
+	if data[3]>>6 == 3 {
+		t.Channels = 1
+	}
+	return true
+}
+
+// samplesPerFrame for layer III.
+func (t *mp3Track) samplesPerFrame() int {
+	if t.MPEGVersion == 1 {
+		return 1152
+	}
+	return 576
+}
+
+// readXingHeader and LAME header in the first frame, if it has them.
+func (t *mp3Track) readXingHeader(frame []byte) {
+	// the Xing header follows the side information
+	offset := 4 + 32
+	switch {
+	case t.MPEGVersion == 1 && t.Channels == 1:
+		offset = 4 + 17
+	case t.MPEGVersion != 1 && t.Channels == 2:
+		offset = 4 + 17
+	case t.MPEGVersion != 1:
+		offset = 4 + 9
+	}
+	if len(frame) < offset+8 {
+		return
+	}
+	id := string(frame[offset : offset+4])
+	if id != "Xing" && id != "Info" {
+		return
+	}
+	t.VBR = id == "Xing"
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	pos := offset + 8
+	if flags&0x01 != 0 && len(frame) >= pos+4 {
+		frames := binary.BigEndian.Uint32(frame[pos:])
+		t.DurationSeconds = float64(frames) * float64(t.samplesPerFrame()) / float64(t.SampleRate)
+		pos += 4
+	}
+	if flags&0x02 != 0 {
+		pos += 4
+	}
+	if flags&0x04 != 0 {
+		// TOC
+		pos += 100
+	}
+	if flags&0x08 != 0 && len(frame) >= pos+4 {
+		t.Quality = int(binary.BigEndian.Uint32(frame[pos:]))
+		pos += 4
+	}
+	// LAME header: encoder (9 bytes), revision and VBR method, lowpass / 100, ..., preset at 26.
+	if len(frame) < pos+28 {
+		return
+	}
+	lame := frame[pos : pos+28]
+	if !bytes.HasPrefix(lame, []byte("LAME")) && !bytes.HasPrefix(lame, []byte("Lavc")) {
+		return
+	}
+	t.Encoder = strings.TrimRight(string(bytes.TrimRight(lame[:9], "\x00 ")), ".")
+	t.Lowpass = int(lame[10]) * 100
+	t.Preset = int(binary.BigEndian.Uint16(lame[26:]) & 0x07ff)
+}
+
+// Encoding of the track, as on Gazelle trackers.
+func (t *mp3Track) Encoding() string {
+	if !t.VBR {
+		switch t.Bitrate {
+		case 320:
+			return encoding320
+		case 256:
+			return encoding256
+		case 192:
+			return encoding192
+		}
+		return encodingOther
+	}
+	// LAME presets: 410 (V9) to 500 (V0), and the older --preset standard (1001, 1004) and extreme (1002, 1005)
+	switch t.Preset {
+	case 500:
+		return encodingV0
+	case 490:
+		return encodingV1
+	case 480:
+		return encodingV2
+	case 1001, 1004:
+		return encodingAPS
+	case 1002, 1005:
+		return encodingAPX
+	}
+	if t.Preset == 0 && strings.HasPrefix(t.Encoder, "LAME") && t.Quality != 0 {
+		// LAME sets the Xing quality to 100 - 10 * V - q
+		switch (100 - t.Quality) / 10 {
+		case 0:
+			return encodingV0
+		case 1:
+			return encodingV1
+		case 2:
+			return encodingV2
+		}
+	}
+	return encodingOther
+}
+
+// relativePath of a file in the release.
+func (p *Propolis) relativePath(path string) string {
+	rel, err := filepath.Rel(p.release.Path, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// CheckMP3Release reads the MP3s of a release without FLACs.
+func (p *Propolis) CheckMP3Release(files []string) {
+	var problems []string
+	for _, f := range files {
+		t, err := readMP3(f)
+		if err != nil {
+			problems = append(problems, p.relativePath(f)+": "+err.Error())
+			continue
+		}
+		p.mp3s = append(p.mp3s, t)
+	}
+	p.ListCheck(LevelCritical, "2.3.1", fmt.Sprintf(OKReleaseHasMP3s, len(p.mp3s)), KOReleaseHasMP3s, problems)
+	if len(p.mp3s) == 0 {
+		p.ConditionCheck(LevelCritical, internalRule, BlankBecauseImpossible, KONoTracks, len(p.mp3s) != 0)
+	}
+}
+
+// CheckMP3Files checks the MPEG streams and the way they were encoded.
+func (p *Propolis) CheckMP3Files() {
+	var sampleRates, encodings, encoders []string
+	var notLayer3, notLAME, lowpass []string
+	for _, t := range p.mp3s {
+		name := p.relativePath(t.Path)
+		sampleRates = append(sampleRates, strconv.Itoa(t.SampleRate))
+		encodings = append(encodings, t.Encoding())
+		encoders = append(encoders, t.Encoder)
+		if t.MPEGVersion != 1 {
+			notLayer3 = append(notLayer3, fmt.Sprintf("%s: MPEG-%d layer III, %dHz", name, t.MPEGVersion, t.SampleRate))
+		}
+		if !strings.HasPrefix(t.Encoder, "LAME") {
+			notLAME = append(notLAME, name)
+		} else if minimum, ok := minimumLAMELowpass[t.Encoding()]; ok && t.Lowpass != 0 && t.Lowpass < minimum {
+			lowpass = append(lowpass, fmt.Sprintf("%s: %s with a %gkHz lowpass, %gkHz or more expected", name, t.Encoding(), float64(t.Lowpass)/1000, float64(minimum)/1000))
+		}
+	}
+	strslice.RemoveDuplicates(&sampleRates)
+	strslice.RemoveDuplicates(&encodings)
+	strslice.RemoveDuplicates(&encoders)
+
+	// checking the encoder
+	p.ConditionCheck(LevelWarning, "2.1.6", OKSameEncoder, fmt.Sprintf(KOSameMP3Encoder, strings.Join(encoders, ", ")), len(encoders) == 1)
+	p.ListCheck(LevelWarning, internalRule, OKMP3LAME, KOMP3LAME, notLAME)
+	// checking the encoding is consistent and preferred
+	p.ConditionCheck(LevelCritical, "2.1.6", fmt.Sprintf(OKMP3Encoding, encodings[0]), fmt.Sprintf(KOMP3Encoding, strings.Join(encodings, ", ")), len(encodings) == 1)
+	if len(encodings) == 1 {
+		p.ConditionCheck(LevelWarning, internalRule, ArrowHeader+OKMP3PreferredEncoding, ArrowHeader+fmt.Sprintf(KOMP3PreferredEncoding, encodings[0]), strslice.Contains(preferredMP3Encodings, encodings[0]))
+	}
+	// checking the stream
+	p.ConditionCheck(LevelWarning, "2.1.6", fmt.Sprintf(OKSameSampleRate, sampleRates[0]), KOSameSampleRate, len(sampleRates) == 1)
+	p.ListCheck(LevelWarning, internalRule, OKMP3MPEG1, KOMP3MPEG1, notLayer3)
+	// checking the lowpass for transcodes
+	p.ListCheck(LevelWarning, "wiki#408", OKMP3Lowpass, KOMP3Lowpass, lowpass)
+	// checking if mutt rip
+	var others []string
+	for _, f := range fs.GetAllowedFilesByExt(p.release.Path, append(nonFlacMusicExtensions, flac.FlacExt)) {
+		if strings.ToLower(filepath.Ext(f)) != mp3Ext {
+			others = append(others, f)
+		}
+	}
+	p.ConditionCheck(LevelCritical, "2.1.6.3", OKMuttRip, fmt.Sprintf(KOMuttRip, strings.Join(others, ",")), len(others) == 0)
+}
+
+// CheckMP3Tags checks the ID3 tags of the MP3s.
+func (p *Propolis) CheckMP3Tags() {
+	var versions []string
+	var noID3v2, oldID3v2, missingFrames, withID3v1 []string
+	albums, albumArtists, years := make([]string, 0), make([]string, 0), make([]string, 0)
+	for _, t := range p.mp3s {
+		name := p.relativePath(t.Path)
+		switch {
+		case t.ID3Version == 0:
+			noID3v2 = append(noID3v2, name)
+			continue
+		case t.ID3Version < 3:
+			oldID3v2 = append(oldID3v2, fmt.Sprintf("%s: ID3v2.%d", name, t.ID3Version))
+			continue
+		}
+		versions = append(versions, fmt.Sprintf("ID3v2.%d", t.ID3Version))
+		var missing []string
+		for _, id := range requiredID3v2Frames {
+			if !strslice.Contains(t.Frames, id) {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) != 0 {
+			missingFrames = append(missingFrames, name+": "+strings.Join(missing, ", "))
+		}
+		if t.ID3v1 {
+			withID3v1 = append(withID3v1, name)
+		}
+		albums = append(albums, t.Album)
+		albumArtists = append(albumArtists, t.AlbumArtist)
+		years = append(years, t.Year)
+	}
+	p.ListCheck(LevelCritical, "2.3.16.1/4", OKMP3ID3v2, KOMP3ID3v2, noID3v2)
+	p.ListCheck(LevelCritical, internalRule, OKMP3ID3v2Version, KOMP3ID3v2Version, oldID3v2)
+	strslice.RemoveDuplicates(&versions)
+	if len(versions) != 0 {
+		p.ConditionCheck(LevelInfo, internalRule, fmt.Sprintf(OKMP3SameID3v2, versions[0]), fmt.Sprintf(KOMP3SameID3v2, strings.Join(versions, ", ")), len(versions) == 1)
+	}
+	p.ListCheck(LevelCritical, "2.3.16.1/4", OKRequiredTags, KORequiredTags, missingFrames)
+	strslice.RemoveDuplicates(&albums)
+	strslice.RemoveDuplicates(&albumArtists)
+	strslice.RemoveDuplicates(&years)
+	p.ConditionCheck(LevelWarning, internalRule, OKConsistentTags, KOConsistentTags, len(albums) <= 1 && len(albumArtists) <= 1 && len(years) <= 1)
+	p.ListCheck(LevelInfo, internalRule, OKMP3ID3v1, KOMP3ID3v1, withID3v1)
+}
+
+// mp3TrackPosition by disc and track number, from the tags.
+func mp3TrackPosition(t *mp3Track) (int, int) {
+	disc := tagNumber(t.DiscNumber)
+	if disc == 0 {
+		disc = 1
+	}
+	return disc, tagNumber(t.TrackNumber)
+}
+
+// checkMP3Filenames checks track numbers and titles are in the filenames, and that filenames sort in the playing order.
+func (p *Propolis) checkMP3Filenames() {
+	var capitalizedExt bool
+	var noNumber, noTitle []string
+	for _, t := range p.mp3s {
+		name := filepath.Base(t.Path)
+		if filepath.Ext(name) != mp3Ext {
+			capitalizedExt = true
+		}
+		if _, number := mp3TrackPosition(t); number == 0 || !strings.Contains(name, fmt.Sprintf("%02d", number)) && !strings.Contains(name, strconv.Itoa(number)) {
+			noNumber = append(noNumber, name)
+		}
+		if !flac.StringContainsStartOfAnother(strings.ToLower(name), strings.ToLower(t.Title), minTitleSize) {
+			noTitle = append(noTitle, name)
+		}
+	}
+	p.ConditionCheck(LevelWarning, internalRule, OKLowerCaseExtensions, KOLowerCaseMP3Extensions, !capitalizedExt)
+	if len(p.mp3s) != 1 {
+		p.ListCheck(LevelCritical, "2.3.13", OKTrackNumbersInFilenames, KOTrackNumbersInFilenames, noNumber)
+	} else {
+		p.ListCheck(LevelWarning, "2.3.13", OKTrackNumberInFilename, KOTrackNumberInFilename, noNumber)
+	}
+	p.ListCheck(LevelCritical, "2.3.11", OKTitleInFilenames, KOTitleInFilenames, noTitle)
+
+	// playing order vs. alphabetical order of the relative paths
+	byPosition := make([]*mp3Track, len(p.mp3s))
+	copy(byPosition, p.mp3s)
+	sort.SliceStable(byPosition, func(i, j int) bool {
+		di, ti := mp3TrackPosition(byPosition[i])
+		dj, tj := mp3TrackPosition(byPosition[j])
+		return di < dj || di == dj && ti < tj
+	})
+	var paths []string
+	for _, t := range p.mp3s {
+		paths = append(paths, p.relativePath(t.Path))
+	}
+	sort.Strings(paths)
+	ordered := true
+	for i, t := range byPosition {
+		if paths[i] != p.relativePath(t.Path) {
+			ordered = false
+			break
+		}
+	}
+	p.ConditionCheck(LevelCritical, "2.3.14./.2", OKFilenameOrder, KOFilenameOrder, ordered)
+}
+
+// checkMP3MultiDiscOrganization: tracks in subfolders must have disc numbers.
+func (p *Propolis) checkMP3MultiDiscOrganization() {
+	var problems []string
+	for _, t := range p.mp3s {
+		if filepath.Dir(t.Path) != filepath.Clean(p.release.Path) && t.DiscNumber == "" {
+			problems = append(problems, p.relativePath(t.Path))
+		}
+	}
+	p.ListCheck(LevelCritical, "2.3.15", OKMultiDiscOrganization, KOMP3MultiDisc, problems)
+}
+
+// checkMP3FolderName checks the folder name mentions the release, the format and the encoding.
+func (p *Propolis) checkMP3FolderName() {
+	first := p.mp3s[0]
+	albumArtists := []string{first.AlbumArtist}
+	if first.AlbumArtist == "" {
+		albumArtists = nil
+		for _, t := range p.mp3s {
+			albumArtists = append(albumArtists, t.Artist)
+		}
+	}
+	folderName := p.checkFolderNameTags(first.Album, albumArtists, first.Year, "")
+	p.ConditionCheck(LevelWarning, "2.3.2", OKMP3InFoldername, KOMP3InFoldername, strings.Contains(folderName, "mp3"))
+	encoding := first.Encoding()
+	if encoding != encodingOther {
+		short := strings.ToLower(strings.TrimSuffix(encoding, " (VBR)"))
+		p.ConditionCheck(LevelWarning, "2.3.2", fmt.Sprintf(OKEncodingInFoldername, short), fmt.Sprintf(KOEncodingInFoldername, short), strings.Contains(folderName, short))
+	}
+	p.checkFolderNameSource(folderName)
+}
@@ -0,0 +1,82 @@
+package propolis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFrameHeader(t *testing.T) {
+	fmt.Println("+ Testing readFrameHeader...")
+	check := assert.New(t)
+
+	cases := []struct {
+		header   []byte
+		valid    bool
+		expected mp3Track
+	}{
+		// MPEG-1, 128kbps, 44.1kHz, joint stereo
+		{[]byte{0xff, 0xfb, 0x90, 0x64}, true, mp3Track{MPEGVersion: 1, Layer: 3, SampleRate: 44100, Bitrate: 128, Channels: 2}},
+		// MPEG-1 with CRC, 320kbps, 48kHz, mono
+		{[]byte{0xff, 0xfa, 0xe4, 0xc4}, true, mp3Track{MPEGVersion: 1, Layer: 3, SampleRate: 48000, Bitrate: 320, Channels: 1}},
+		// MPEG-2, 64kbps, 22.05kHz, stereo
+		{[]byte{0xff, 0xf3, 0x80, 0x00}, true, mp3Track{MPEGVersion: 2, Layer: 3, SampleRate: 22050, Bitrate: 64, Channels: 2}},
+		// MPEG-2.5, 32kbps, 11.025kHz, dual channel
+		{[]byte{0xff, 0xe3, 0x40, 0x80}, true, mp3Track{MPEGVersion: 3, Layer: 3, SampleRate: 11025, Bitrate: 32, Channels: 2}},
+		// no sync
+		{[]byte{0x49, 0x44, 0x33, 0x03}, false, mp3Track{}},
+		{[]byte{0xff, 0x1b, 0x90, 0x64}, false, mp3Track{}},
+		// reserved version
+		{[]byte{0xff, 0xeb, 0x90, 0x64}, false, mp3Track{}},
+		// layer II and layer I
+		{[]byte{0xff, 0xfd, 0x90, 0x64}, false, mp3Track{}},
+		{[]byte{0xff, 0xff, 0x90, 0x64}, false, mp3Track{}},
+		// free format, bad bitrate, reserved sample rate
+		{[]byte{0xff, 0xfb, 0x00, 0x64}, false, mp3Track{}},
+		{[]byte{0xff, 0xfb, 0xf0, 0x64}, false, mp3Track{}},
+		{[]byte{0xff, 0xfb, 0x9c, 0x64}, false, mp3Track{}},
+	}
+	for _, c := range cases {
+		track := mp3Track{}
+		check.Equal(c.valid, track.readFrameHeader(c.header), fmt.Sprintf("% x", c.header))
+		check.Equal(c.expected, track, fmt.Sprintf("% x", c.header))
+	}
+}
+
+func TestMP3Encoding(t *testing.T) {
+	fmt.Println("+ Testing mp3Track.Encoding...")
+	check := assert.New(t)
+
+	cases := []struct {
+		track    mp3Track
+		expected string
+	}{
+		{mp3Track{Bitrate: 320}, encoding320},
+		{mp3Track{Bitrate: 256}, encoding256},
+		{mp3Track{Bitrate: 192}, encoding192},
+		{mp3Track{Bitrate: 128}, encodingOther},
+		// CBR with a LAME Info header
+		{mp3Track{Bitrate: 320, Encoder: "LAME3.100", Preset: 320, Quality: 58}, encoding320},
+		// LAME presets
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.100", Preset: 500}, encodingV0},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.100", Preset: 490}, encodingV1},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.100", Preset: 480}, encodingV2},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.97", Preset: 1001}, encodingAPS},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.90", Preset: 1004}, encodingAPS},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.97", Preset: 1002}, encodingAPX},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.90", Preset: 1005}, encodingAPX},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.100", Preset: 470}, encodingOther},
+		// no preset, from the Xing quality
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.99", Quality: 98}, encodingV0},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.99", Quality: 88}, encodingV1},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.99", Quality: 78}, encodingV2},
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "LAME3.99", Quality: 58}, encodingOther},
+		// other encoders
+		{mp3Track{VBR: true, Bitrate: 128, Encoder: "Lavc58.54", Quality: 98}, encodingOther},
+		{mp3Track{VBR: true, Bitrate: 320}, encodingOther},
+	}
+	for _, c := range cases {
+		check.Equal(c.expected, c.track.Encoding(), fmt.Sprintf("%+v", c.track))
+	}
+}
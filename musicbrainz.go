@@ -0,0 +1,204 @@
+package propolis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+const (
+	musicBrainzAlbumIDField = "MUSICBRAINZ_ALBUMID"
+	musicBrainzUserAgent    = "propolis ( https://gitlab.com/passelecasque/propolis )"
+)
+
+var (
+	barcodeFields = []string{flac.TagBarcode, flac.TagUPC}
+	// musicBrainzID is a lowercase UUID.
+	musicBrainzID = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+type musicBrainzTrack struct {
+	Position int    `json:"position"`
+	Title    string `json:"title"`
+	// Length in milliseconds.
+	Length int `json:"length"`
+}
+
+type musicBrainzMedium struct {
+	Position int                `json:"position"`
+	Format   string             `json:"format"`
+	Tracks   []musicBrainzTrack `json:"tracks"`
+}
+
+// musicBrainzRelease is the part of a MusicBrainz release lookup that can be compared with the tracks.
+type musicBrainzRelease struct {
+	ID      string              `json:"id"`
+	Title   string              `json:"title"`
+	Barcode string              `json:"barcode"`
+	Media   []musicBrainzMedium `json:"media"`
+}
+
+func (r *musicBrainzRelease) trackCount() int {
+	var count int
+	for _, m := range r.Media {
+		count += len(m.Tracks)
+	}
+	return count
+}
+
+// track at a disc and track position, nil if there is none.
+func (r *musicBrainzRelease) track(disc, position int) *musicBrainzTrack {
+	for _, m := range r.Media {
+		if m.Position != disc {
+			continue
+		}
+		for i := range m.Tracks {
+			if m.Tracks[i].Position == position {
+				return &m.Tracks[i]
+			}
+		}
+	}
+	return nil
+}
+
+// lookupMusicBrainzRelease with its tracks, using the cache first so that releases can be checked offline.
+func lookupMusicBrainzRelease(baseURL, id string, cache *analysisCache) (*musicBrainzRelease, error) {
+	id = strings.ToLower(id)
+	if !musicBrainzID.MatchString(id) {
+		return nil, errors.New("invalid MusicBrainz release ID " + id)
+	}
+	data := cache.getMusicBrainz(id)
+	if data == nil {
+		req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/ws/2/release/"+id+"?inc=recordings&fmt=json", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", musicBrainzUserAgent)
+		req.Header.Set("Accept", "application/json")
+		client := &http.Client{Timeout: trackerTimeout}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New("MusicBrainz returned " + resp.Status)
+		}
+		if data, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+		cache.setMusicBrainz(id, data)
+	}
+	var release musicBrainzRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, errors.Wrap(err, "could not read MusicBrainz release")
+	}
+	return &release, nil
+}
+
+// tagNumber from track or disc number tags, ignoring totals ("3/12").
+func tagNumber(value string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(strings.Split(value, "/")[0]))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// compareWithMusicBrainz returns the track titles and durations that do not match, by disc and track number.
+func compareWithMusicBrainz(flacs []*flac.Flac, release *musicBrainzRelease) ([]string, []string) {
+	var titles, durations []string
+	for i, f := range flacs {
+		tags := f.CommonTags()
+		disc, position := tagNumber(tags.DiscNumber), tagNumber(tags.TrackNumber)
+		if disc == 0 {
+			disc = 1
+		}
+		if position == 0 {
+			// no usable track number, assuming tracks are in order
+			position = i + 1
+		}
+		track := release.track(disc, position)
+		name := filepath.Base(f.Path)
+		if track == nil {
+			titles = append(titles, fmt.Sprintf("%s: no track %d on disc %d", name, position, disc))
+			continue
+		}
+		if !sameTitle(track.Title, tags.Title) {
+			titles = append(titles, fmt.Sprintf("%s: %q, MusicBrainz has %q", name, tags.Title, track.Title))
+		}
+		if track.Length != 0 {
+			expected := float64(track.Length) / 1000
+			if math.Abs(float64(f.DurationSeconds)-expected) > trackDurationTolerance {
+				durations = append(durations, fmt.Sprintf("%s: %s, MusicBrainz has %s", name, formatDuration(float64(f.DurationSeconds)), formatDuration(expected)))
+			}
+		}
+	}
+	return titles, durations
+}
+
+// discLayout of the tracks: number of tracks by disc number.
+func discLayout(flacs []*flac.Flac) map[int]int {
+	layout := make(map[int]int)
+	for _, f := range flacs {
+		disc := tagNumber(f.CommonTags().DiscNumber)
+		if disc == 0 {
+			disc = 1
+		}
+		layout[disc]++
+	}
+	return layout
+}
+
+// CheckMusicBrainz compares the release with the MusicBrainz release its tags point to.
+func (p *Propolis) CheckMusicBrainz(baseURL string) {
+	var ids []string
+	for _, f := range p.release.Flacs {
+		if id := rawTagValue(f, musicBrainzAlbumIDField); id != "" && !strslice.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		p.ConditionCheck(LevelInfo, internalRule, OKNoMusicBrainzID, BlankBecauseImpossible, true)
+		return
+	}
+	p.ConditionCheck(LevelWarning, internalRule, OKMusicBrainzID, fmt.Sprintf(KOMusicBrainzID, strings.Join(ids, ", ")), len(ids) == 1)
+	release, err := lookupMusicBrainzRelease(baseURL, ids[0], p.cache)
+	p.ErrorCheck(LevelInfo, internalRule, fmt.Sprintf(OKMusicBrainzLookup, ids[0]), KOMusicBrainzLookup, err, AppendError)
+	if err != nil {
+		return
+	}
+
+	p.ConditionCheck(LevelWarning, internalRule, OKMusicBrainzTrackCount, fmt.Sprintf(KOMusicBrainzTrackCount, len(p.release.Flacs), release.trackCount()), len(p.release.Flacs) == release.trackCount())
+	var layoutProblems []string
+	layout := discLayout(p.release.Flacs)
+	for _, m := range release.Media {
+		if layout[m.Position] != len(m.Tracks) {
+			layoutProblems = append(layoutProblems, fmt.Sprintf("disc %d (%s): %d track(s), MusicBrainz has %d", m.Position, m.Format, layout[m.Position], len(m.Tracks)))
+		}
+	}
+	if len(layout) > len(release.Media) {
+		layoutProblems = append(layoutProblems, fmt.Sprintf("%d disc(s) in tags, MusicBrainz has %d", len(layout), len(release.Media)))
+	}
+	p.ListCheck(LevelWarning, internalRule, OKMusicBrainzDiscs, KOMusicBrainzDiscs, layoutProblems)
+
+	titles, durations := compareWithMusicBrainz(p.release.Flacs, release)
+	p.ListCheck(LevelWarning, internalRule, OKMusicBrainzTitles, KOMusicBrainzTitles, titles)
+	p.ListCheck(LevelWarning, internalRule, OKMusicBrainzDurations, KOMusicBrainzDurations, durations)
+
+	if barcode := rawTagValue(p.release.Flacs[0], barcodeFields...); barcode != "" && release.Barcode != "" {
+		// UPCs are EANs without the leading 0
+		same := strings.TrimLeft(barcode, "0") == strings.TrimLeft(release.Barcode, "0")
+		p.ConditionCheck(LevelWarning, internalRule, OKMusicBrainzBarcode, fmt.Sprintf(KOMusicBrainzBarcode, barcode, release.Barcode), same)
+	}
+}
@@ -0,0 +1,138 @@
+package propolis
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/flac"
+)
+
+const (
+	testMusicBrainzID = "0b5e1a5c-7b2a-4d53-9b3c-2f3e5c6d7e8f"
+	// two discs, the second one with a single track
+	testMusicBrainzJSON = `{
+		"id": "0b5e1a5c-7b2a-4d53-9b3c-2f3e5c6d7e8f",
+		"title": "Album",
+		"barcode": "0123456789012",
+		"media": [
+			{"position": 1, "format": "CD", "tracks": [
+				{"position": 1, "title": "One", "length": 1000},
+				{"position": 2, "title": "Two", "length": 2000}
+			]},
+			{"position": 2, "format": "CD", "tracks": [
+				{"position": 1, "title": "Three", "length": 1000}
+			]}
+		]
+	}`
+)
+
+func TestLookupMusicBrainzRelease(t *testing.T) {
+	fmt.Println("+ Testing lookupMusicBrainzRelease...")
+	check := assert.New(t)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/ws/2/release/"+testMusicBrainzID || r.URL.Query().Get("inc") != "recordings" || r.Header.Get("User-Agent") != musicBrainzUserAgent {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testMusicBrainzJSON)
+	}))
+	defer server.Close()
+
+	cache := loadCache(filepath.Join(t.TempDir(), cacheFile), "v1")
+	release, err := lookupMusicBrainzRelease(server.URL+"/", testMusicBrainzID, cache)
+	check.Nil(err)
+	check.Equal(1, requests)
+	check.Equal("Album", release.Title)
+	check.Equal(3, release.trackCount())
+	check.Equal("Three", release.track(2, 1).Title)
+	check.Nil(release.track(2, 2))
+
+	// IDs are case insensitive, and lookups are cached
+	release, err = lookupMusicBrainzRelease(server.URL, "0B5E1A5C-7B2A-4D53-9B3C-2F3E5C6D7E8F", cache)
+	check.Nil(err)
+	check.Equal(1, requests)
+	check.Equal("Album", release.Title)
+
+	// lookups are kept when the cache was saved by another version
+	check.Nil(cache.save())
+	cache = loadCache(cache.path, "v2")
+	_, err = lookupMusicBrainzRelease(server.URL, testMusicBrainzID, cache)
+	check.Nil(err)
+	check.Equal(1, requests)
+
+	// invalid IDs are not looked up
+	for _, id := range []string{"", "not-a-uuid", "../../../other?", testMusicBrainzID + "/x", "0b5e1a5c7b2a4d539b3c2f3e5c6d7e8f"} {
+		_, err = lookupMusicBrainzRelease(server.URL, id, nil)
+		check.NotNil(err, id)
+	}
+	check.Equal(1, requests)
+
+	// unknown releases
+	_, err = lookupMusicBrainzRelease(server.URL, "11111111-2222-3333-4444-555555555555", nil)
+	check.NotNil(err)
+	check.Equal(2, requests)
+}
+
+func TestCompareWithMusicBrainz(t *testing.T) {
+	fmt.Println("+ Testing compareWithMusicBrainz...")
+	check := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testMusicBrainzJSON)
+	}))
+	defer server.Close()
+	release, err := lookupMusicBrainzRelease(server.URL, testMusicBrainzID, nil)
+	check.Nil(err)
+
+	dir := t.TempDir()
+	second := testSampleRate
+	flacs := []*flac.Flac{
+		writeTestFlac(t, filepath.Join(dir, "CD1", "01.flac"), 2, second, noise, "TITLE=One", "TRACKNUMBER=1", "DISCNUMBER=1/2"),
+		// wrong title, wrong duration
+		writeTestFlac(t, filepath.Join(dir, "CD1", "02.flac"), 2, 5*second, noise, "TITLE=Deux", "TRACKNUMBER=2/2", "DISCNUMBER=1"),
+		writeTestFlac(t, filepath.Join(dir, "CD2", "01.flac"), 2, second, noise, "TITLE=Three", "TRACKNUMBER=1", "DISCNUMBER=2"),
+		// not on MusicBrainz
+		writeTestFlac(t, filepath.Join(dir, "CD2", "02.flac"), 2, second, noise, "TITLE=Bonus", "TRACKNUMBER=2", "DISCNUMBER=2"),
+	}
+	titles, durations := compareWithMusicBrainz(flacs, release)
+	check.Equal([]string{`02.flac: "Deux", MusicBrainz has "Two"`, "02.flac: no track 2 on disc 2"}, titles)
+	check.Equal(1, len(durations))
+	check.Contains(durations[0], "02.flac: ")
+	check.Equal(map[int]int{1: 2, 2: 2}, discLayout(flacs))
+
+	// without disc or track numbers, tracks are assumed to be in order, on the first disc
+	flacs = []*flac.Flac{
+		writeTestFlac(t, filepath.Join(dir, "untagged", "a.flac"), 2, second, noise, "TITLE=One"),
+		writeTestFlac(t, filepath.Join(dir, "untagged", "b.flac"), 2, 2*second, noise, "TITLE=Two"),
+	}
+	titles, durations = compareWithMusicBrainz(flacs, release)
+	check.Empty(titles)
+	check.Empty(durations)
+	check.Equal(map[int]int{1: 2}, discLayout(flacs))
+}
+
+func TestTagNumber(t *testing.T) {
+	fmt.Println("+ Testing tagNumber...")
+	check := assert.New(t)
+
+	cases := map[string]int{
+		"1":     1,
+		"03":    3,
+		" 7 ":   7,
+		"3/12":  3,
+		"":      0,
+		"A1":    0,
+		"x/12":  0,
+		"12/12": 12,
+	}
+	for value, expected := range cases {
+		check.Equal(expected, tagNumber(value), value)
+	}
+}
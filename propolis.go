@@ -11,18 +11,30 @@ import (
 
 	"gitlab.com/catastrophic/assistance/logthis"
 	"gitlab.com/catastrophic/assistance/music"
+	"gitlab.com/catastrophic/assistance/strslice"
 )
 
 type Propolis struct {
 	Path         string   `json:"path"`
 	Checks       []*Check `json:"checks"`
 	release      *music.Release
+	mp3s         []*mp3Track
 	stdOutput    bool
 	problemsOnly bool
+	disabled     []string
+	jobs         int
+	cache        *analysisCache
+	artwork      []*embeddedArtwork
+	artworkErr   error
+	artworkRead  bool
+	sections     []reportSection
 	buffer       bytes.Buffer
 	Passed       int
 	Errors       int
 	Warnings     int
+
+	// declaredSource overrides the guessed source, see SetSource.
+	declaredSource string
 }
 
 func NewPropolis(path string, release *music.Release, problemsOnly bool) *Propolis {
@@ -40,7 +52,41 @@ func (p *Propolis) ToggleStdOutput(enabled bool) {
 	}
 }
 
+// DisableChecks by name, see OptionalChecks.
+func (p *Propolis) DisableChecks(names []string) {
+	p.disabled = names
+}
+
+// SetJobs sets how many tracks can be analysed at the same time, 0 meaning one per CPU.
+func (p *Propolis) SetJobs(jobs int) {
+	p.jobs = jobs
+}
+
+// UseCache saved in path, its track results are ignored if it was saved by a different version.
+func (p *Propolis) UseCache(path, version string) {
+	p.cache = loadCache(path, version)
+}
+
+// SaveCache if one is used.
+func (p *Propolis) SaveCache() error {
+	return p.cache.save()
+}
+
+func (p *Propolis) isEnabled(name string) bool {
+	return !strslice.Contains(p.disabled, name)
+}
+
+// embeddedArtwork of the release, only read once.
+func (p *Propolis) embeddedArtwork() ([]*embeddedArtwork, error) {
+	if !p.artworkRead {
+		p.artwork, p.artworkErr = getEmbeddedArtwork(p.release.Flacs, p.jobs)
+		p.artworkRead = true
+	}
+	return p.artwork, p.artworkErr
+}
+
 func (p *Propolis) ParseResults() {
+	identifyChecks(p.Checks)
 	p.Passed, p.Warnings, p.Errors = 0, 0, 0
 	for _, c := range p.Checks {
 		switch c.Result {
@@ -75,6 +121,14 @@ func (p *Propolis) ErrorCheck(level Level, rule, OKString, KOString string, err
 	p.Checks = append(p.Checks, check)
 }
 
+// ListCheck adds a summary check and one sub-check per problem found.
+func (p *Propolis) ListCheck(level Level, rule, OKString, KOString string, problems []string) {
+	p.ConditionCheck(level, rule, OKString, KOString, len(problems) == 0)
+	for _, pb := range problems {
+		p.ConditionCheck(level, rule, BlankBecauseImpossible, ArrowHeader+pb, false)
+	}
+}
+
 func (p *Propolis) AllErrors() []string {
 	var errors []string
 	for _, c := range p.Checks {
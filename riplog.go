@@ -0,0 +1,113 @@
+package propolis
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	ripperEAC     = "EAC"
+	ripperXLD     = "XLD"
+	ripperUnknown = "unknown"
+)
+
+// ripLogDeduction is something a rip log should show, and how many points are lost if it does not.
+type ripLogDeduction struct {
+	description string
+	points      int
+	// found is true if the log shows what is expected.
+	found func(log string) bool
+}
+
+func logContains(substrings ...string) func(string) bool {
+	return func(log string) bool {
+		for _, s := range substrings {
+			if strings.Contains(log, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func logMatches(expr string) func(string) bool {
+	re := regexp.MustCompile(expr)
+	return re.MatchString
+}
+
+func logDoesNotContain(substring string) func(string) bool {
+	return func(log string) bool {
+		return !strings.Contains(log, substring)
+	}
+}
+
+var (
+	// main deductions of the tracker logcheckers, by ripper.
+	// this is only an approximation, to compare releases.
+	ripLogDeductions = map[string][]ripLogDeduction{
+		ripperEAC: {
+			{"no log checksum", 15, logContains("==== Log checksum")},
+			{"not ripped in secure mode", 40, logMatches(`Read mode\s*:\s*Secure`)},
+			{"audio cache not defeated", 10, logMatches(`Defeat audio cache\s*:\s*Yes`)},
+			{"test and copy not used", 10, logContains("Test CRC")},
+			{"suspicious positions", 20, logDoesNotContain("Suspicious position")},
+		},
+		ripperXLD: {
+			{"no log checksum", 15, logContains("-----BEGIN XLD SIGNATURE-----")},
+			{"not ripped in secure mode", 40, logMatches(`Ripper mode\s*:\s*(XLD Secure Ripper|CDParanoia III)`)},
+			{"audio cache not defeated", 10, logMatches(`Disable audio cache\s*:\s*OK`)},
+			{"test and copy not used", 10, logContains("CRC32 hash (test run)")},
+			{"suspicious positions", 20, logDoesNotContain("uspicious position")},
+		},
+	}
+)
+
+// ripLog is a CD rip log, with an approximate score.
+type ripLog struct {
+	path       string
+	ripper     string
+	score      int
+	deductions []string
+}
+
+// readRipLog and score it, decoding UTF-16 logs as written by EAC.
+func readRipLog(path string) (*ripLog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		data, err = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	content := string(data)
+
+	l := &ripLog{path: filepath.Base(path), ripper: ripperUnknown}
+	switch {
+	case strings.Contains(content, "Exact Audio Copy"):
+		l.ripper = ripperEAC
+	case strings.Contains(content, "X Lossless Decoder"):
+		l.ripper = ripperXLD
+	default:
+		l.deductions = append(l.deductions, "unknown ripper")
+		return l, nil
+	}
+	l.score = 100
+	for _, d := range ripLogDeductions[l.ripper] {
+		if !d.found(content) {
+			l.score -= d.points
+			l.deductions = append(l.deductions, d.description)
+		}
+	}
+	if l.score < 0 {
+		l.score = 0
+	}
+	return l, nil
+}
@@ -1,8 +1,10 @@
 package propolis
 
 import (
+	"os"
 	"path/filepath"
 
+	"github.com/pkg/errors"
 	"gitlab.com/catastrophic/assistance/logthis"
 	"gitlab.com/catastrophic/assistance/music"
 	"gitlab.com/catastrophic/assistance/ui"
@@ -12,12 +14,8 @@ var (
 	log = &Log{}
 )
 
-func Run(path, metadataRoot string, disableSpecs, disableCombinedSpecs, problemsOnly, snatched, jsonOutput, stdOutput bool, version string) (*Propolis, string, error) {
-	logthis.Info(ui.YellowBold(ArrowHeader+"Analysing "+path), logthis.NORMAL)
-
-	// setting output config
-	log.problemsOnly = problemsOnly
-
+// MetadataDir returns where propolis metadata (spectrograms, logs, etc) is saved for a release.
+func MetadataDir(path, metadataRoot string, snatched bool) string {
 	// by default, metadata (spectrograms, etc), will be put in a side folder.
 	metadataDir := path + " (Metadata)"
 	if metadataRoot != "" {
@@ -26,12 +24,145 @@ func Run(path, metadataRoot string, disableSpecs, disableCombinedSpecs, problems
 	if snatched {
 		metadataDir = filepath.Join(path, "Metadata")
 	}
+	return metadataDir
+}
+
+// CachePath returns where the analysis cache is saved: in the metadata root if there is one, otherwise with the
+// release metadata.
+func CachePath(metadataDir, metadataRoot string) string {
+	if metadataRoot != "" {
+		return filepath.Join(metadataRoot, cacheFile)
+	}
+	return filepath.Join(metadataDir, cacheFile)
+}
+
+// checkGroup is a set of checks displayed under the same title.
+type checkGroup struct {
+	title string
+	run   func(p *Propolis, options Options)
+	// enabled, if set, tells if the group applies with these options.
+	enabled func(options Options) bool
+}
+
+func (g checkGroup) enabledFor(options Options) bool {
+	return g.enabled == nil || g.enabled(options)
+}
+
+var (
+	// releaseCheckGroup is always run first.
+	releaseCheckGroup = checkGroup{title: TitleRelease, run: func(p *Propolis, _ Options) { p.CheckRelease() }}
+	// checkGroups run in this order, if the release has tracks.
+	checkGroups = []checkGroup{
+		{title: TitleMusic, run: func(p *Propolis, _ Options) { p.CheckMusicFiles() }},
+		{title: TitleOrganization, run: func(p *Propolis, o Options) { p.CheckOrganization(o.Snatched) }},
+		{title: TitleTags, run: func(p *Propolis, _ Options) {
+			p.CheckTags()
+			p.CheckTagHygiene()
+		}},
+		{title: TitleArtwork, run: func(p *Propolis, _ Options) { p.CheckArtwork() }},
+		{title: TitleFilenames, run: func(p *Propolis, o Options) { p.CheckFilenames(o.Snatched) }},
+		{title: TitleExtraFiles, run: func(p *Propolis, _ Options) { p.CheckExtraFiles() }},
+		{title: TitleChecksums, run: func(p *Propolis, o Options) { p.CheckChecksumFiles(o.Snatched) }},
+		{title: TitleFoldername, run: func(p *Propolis, _ Options) { p.CheckFolderName() }},
+		{title: TitleTracker, run: func(p *Propolis, _ Options) { p.CheckTrackerMetadata() }, enabled: func(o Options) bool { return o.Snatched }},
+		{title: TitleMusicBrainz, run: func(p *Propolis, o Options) { p.CheckMusicBrainz(o.MusicBrainzURL) }, enabled: func(o Options) bool { return o.MusicBrainzURL != "" }},
+		{title: TitleDupes, run: func(p *Propolis, o Options) { p.CheckDupes(o.TrackerURL, o.TrackerAPIKey) }, enabled: func(o Options) bool { return o.TrackerURL != "" }},
+		sourceCheckGroup,
+		torrentCheckGroup,
+	}
+	// mp3CheckGroups run in this order, if the release only has MP3 tracks.
+	mp3CheckGroups = []checkGroup{
+		{title: TitleMusic, run: func(p *Propolis, _ Options) { p.CheckMP3Files() }},
+		{title: TitleOrganization, run: func(p *Propolis, o Options) { p.CheckOrganization(o.Snatched) }},
+		{title: TitleTags, run: func(p *Propolis, _ Options) { p.CheckMP3Tags() }},
+		{title: TitleFilenames, run: func(p *Propolis, o Options) { p.CheckFilenames(o.Snatched) }},
+		{title: TitleExtraFiles, run: func(p *Propolis, _ Options) { p.CheckExtraFiles() }},
+		{title: TitleChecksums, run: func(p *Propolis, o Options) { p.CheckChecksumFiles(o.Snatched) }},
+		{title: TitleFoldername, run: func(p *Propolis, _ Options) { p.CheckFolderName() }},
+		sourceCheckGroup,
+		torrentCheckGroup,
+	}
+	sourceCheckGroup = checkGroup{title: TitleSource, run: func(p *Propolis, o Options) {
+		p.CheckSource(MetadataDir(p.release.Path, o.MetadataRoot, o.Snatched))
+	}}
+	torrentCheckGroup = checkGroup{title: TitleTorrent, run: func(p *Propolis, o Options) {
+		p.CheckTorrent(o.TorrentFile, MetadataDir(p.release.Path, o.MetadataRoot, o.Snatched), o.Snatched)
+	}, enabled: func(o Options) bool { return o.Snatched || o.TorrentFile != "" }}
+)
+
+// checkGroups for the tracks found by the release checks, none if there are no tracks.
+func (p *Propolis) checkGroups() []checkGroup {
+	switch {
+	case len(p.release.Flacs) != 0:
+		return checkGroups
+	case len(p.mp3s) != 0:
+		return mp3CheckGroups
+	default:
+		return nil
+	}
+}
+
+// runCheckGroup and return the checks it added.
+func (p *Propolis) runCheckGroup(g checkGroup, options Options) []*Check {
+	logthis.Info(titleHeader+ui.BlueBoldUnderlined(g.title), logthis.NORMAL)
+	before := len(p.Checks)
+	g.run(p, options)
+	p.sections = append(p.sections, reportSection{Title: g.title, Checks: p.Checks[before:]})
+	return p.Checks[before:]
+}
+
+// Options for analysing a release.
+type Options struct {
+	// MetadataRoot is where metadata folders are created, next to the release if empty.
+	MetadataRoot         string
+	DisableSpecs         bool
+	DisableCombinedSpecs bool
+	ProblemsOnly         bool
+	Snatched             bool
+	JSONOutput           bool
+	StdOutput            bool
+	SpectrogramBackend   string
+	// Jobs is the number of tracks analysed at the same time, 0 meaning one per CPU.
+	Jobs           int
+	DisabledChecks []string
+	Manifest       bool
+	DisableCache   bool
+	HTMLOutput     bool
+	// Description format, see DescriptionFormats, none if empty.
+	Description         string
+	DescriptionTemplate string
+	// TorrentFile to compare the release with, found in varroa's metadata in snatched mode if empty.
+	TorrentFile string
+	// TrackerURL of a Gazelle tracker to look for duplicates on, with its API key.
+	TrackerURL    string
+	TrackerAPIKey string
+	// MusicBrainzURL is the base URL of the MusicBrainz web service to compare releases with, if set.
+	MusicBrainzURL string
+	// ExportUpload is where the upload form fields are saved as JSON, if set.
+	ExportUpload string
+	// Source of the release, see Sources, guessed from its files if empty.
+	Source string
+}
+
+func Run(path string, options Options, version string) (*Propolis, string, error) {
+	logthis.Info(ui.YellowBold(ArrowHeader+"Analysing "+path), logthis.NORMAL)
+
+	// setting output config
+	log.problemsOnly = options.ProblemsOnly
+
+	metadataDir := MetadataDir(path, options.MetadataRoot, options.Snatched)
 	release := music.NewWithExternalMetadata(path, metadataDir)
 
 	// creating overall check struct and adding the first checks
-	analysis := NewPropolis(path, release, problemsOnly)
+	analysis := NewPropolis(path, release, options.ProblemsOnly)
 	defer analysis.Clear()
-	if jsonOutput || !stdOutput {
+	analysis.DisableChecks(options.DisabledChecks)
+	analysis.SetJobs(options.Jobs)
+	analysis.SetSource(options.Source)
+	if !options.DisableCache {
+		analysis.UseCache(CachePath(metadataDir, options.MetadataRoot), version)
+	}
+	if options.JSONOutput || !options.StdOutput {
 		analysis.ToggleStdOutput(false)
 	}
 
@@ -39,42 +170,99 @@ func Run(path, metadataRoot string, disableSpecs, disableCombinedSpecs, problems
 	var err error
 
 	// general checks
-	logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleRelease), logthis.NORMAL)
-	analysis.CheckRelease()
+	analysis.runCheckGroup(releaseCheckGroup, options)
+	for _, g := range analysis.checkGroups() {
+		if g.enabledFor(options) {
+			analysis.runCheckGroup(g, options)
+		}
+	}
 	if len(analysis.release.Flacs) != 0 {
-		logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleMusic), logthis.NORMAL)
-		analysis.CheckMusicFiles()
-		logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleOrganization), logthis.NORMAL)
-		analysis.CheckOrganization(snatched)
-		logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleTags), logthis.NORMAL)
-		analysis.CheckTags()
-		logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleFilenames), logthis.NORMAL)
-		analysis.CheckFilenames(snatched)
-		logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleExtraFiles), logthis.NORMAL)
-		analysis.CheckExtraFiles()
-		logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleFoldername), logthis.NORMAL)
-		analysis.CheckFolderName()
-
-		if !disableSpecs {
+		if !options.DisableSpecs {
 			logthis.Info(titleHeader+ui.BlueBoldUnderlined("Generating spectrograms"), logthis.NORMAL)
-			overviewFile, err = GenerateSpectrograms(release, !disableCombinedSpecs, stdOutput && !jsonOutput)
+			analysis.restoreSpectrograms()
+			overviewFile, err = GenerateSpectrograms(release, options.SpectrogramBackend, options.Jobs, !options.DisableCombinedSpecs, options.StdOutput && !options.JSONOutput)
 			if err != nil {
 				logthis.Error(err, logthis.NORMAL)
 			} else {
 				logthis.Info(ui.BlueBold("Spectrograms generated in "+metadataDir+". Check for transcodes (see wiki#408)."), logthis.NORMAL)
 			}
+			analysis.cacheSpectrograms()
+		}
+
+		if err := analysis.SaveCache(); err != nil {
+			logthis.Error(errors.Wrap(err, "could not save cache"), logthis.NORMAL)
 		}
 	}
-	if jsonOutput {
+	if options.JSONOutput {
 		analysis.ToggleStdOutput(true)
 		// TODO take --only-problems into account!
 		logthis.Info(analysis.JSONOutput(), logthis.NORMAL)
 	} else {
 		logthis.Info("\n"+titleHeader+ui.BlueBoldUnderlined("Results\n")+ui.Blue(analysis.Summary()), logthis.NORMAL)
 	}
-	// saving log to file
-	if err != analysis.SaveOuput(metadataDir, version) {
+	// saving log to file, the metadata folder is not created by spectrograms for MP3 releases
+	if err := os.MkdirAll(metadataDir, 0777); err != nil {
 		return analysis, overviewFile, err
 	}
+	if err := analysis.SaveOuput(metadataDir, version); err != nil {
+		return analysis, overviewFile, err
+	}
+	// saving the HTML report, with spectrograms
+	if options.HTMLOutput {
+		htmlFile, err := analysis.SaveHTML(metadataDir, overviewFile, version)
+		if err != nil {
+			return analysis, overviewFile, err
+		}
+		logthis.Info(ui.BlueBold("HTML report saved in "+htmlFile+"."), logthis.NORMAL)
+	}
+	// saving the upload description
+	if options.Description != "" {
+		descriptionFile, err := analysis.SaveDescription(metadataDir, options.Description, options.DescriptionTemplate, overviewFile)
+		if err != nil {
+			return analysis, overviewFile, err
+		}
+		logthis.Info(ui.BlueBold("Release description saved in "+descriptionFile+"."), logthis.NORMAL)
+	}
+	// saving the upload form, with a BBCode description
+	if options.ExportUpload != "" {
+		var descriptionTemplate string
+		if options.Description == DescriptionBBCode {
+			descriptionTemplate = options.DescriptionTemplate
+		}
+		if err := analysis.SaveUploadForm(options.ExportUpload, descriptionTemplate, overviewFile); err != nil {
+			return analysis, overviewFile, err
+		}
+		logthis.Info(ui.BlueBold("Upload form saved in "+options.ExportUpload+"."), logthis.NORMAL)
+	}
+	// saving manifest, only for releases without problems
+	if options.Manifest {
+		analysis.ParseResults()
+		if analysis.Errors != 0 {
+			logthis.Info(ui.Yellow("Not generating manifest, the release has problems."), logthis.NORMAL)
+		} else if err := analysis.SaveManifest(metadataDir, options.Snatched, version); err != nil {
+			return analysis, overviewFile, err
+		} else {
+			logthis.Info(ui.BlueBold("Manifest saved in "+metadataDir+"."), logthis.NORMAL)
+		}
+	}
 	return analysis, overviewFile, nil
 }
+
+// Verify a release against the manifest saved in its metadata folder.
+func Verify(path, metadataRoot string, snatched bool) (*Propolis, error) {
+	logthis.Info(ui.YellowBold(ArrowHeader+"Verifying "+path), logthis.NORMAL)
+	metadataDir := MetadataDir(path, metadataRoot, snatched)
+	analysis := NewPropolis(path, music.NewWithExternalMetadata(path, metadataDir), false)
+
+	logthis.Info(titleHeader+ui.BlueBoldUnderlined(TitleManifest), logthis.NORMAL)
+	added, removed, modified, err := compareWithManifest(path, filepath.Join(metadataDir, manifestName+md5Ext), snatched)
+	analysis.ErrorCheck(LevelCritical, internalRule, OKManifestFound, KOManifestFound, err, AppendError)
+	if err != nil {
+		return analysis, err
+	}
+	analysis.ListCheck(LevelCritical, internalRule, OKManifestRemoved, KOManifestRemoved, removed)
+	analysis.ListCheck(LevelCritical, internalRule, OKManifestModified, KOManifestModified, modified)
+	analysis.ListCheck(LevelWarning, internalRule, OKManifestAdded, KOManifestAdded, added)
+	logthis.Info("\n"+titleHeader+ui.BlueBoldUnderlined("Results\n")+ui.Blue(analysis.Summary()), logthis.NORMAL)
+	return analysis, nil
+}
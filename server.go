@@ -0,0 +1,261 @@
+package propolis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/strslice"
+	"gitlab.com/catastrophic/assistance/ui"
+)
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+
+	// maximum number of jobs waiting to be run.
+	jobQueueSize = 100
+	// finished jobs are forgotten after a while, the most recent ones being kept.
+	finishedJobRetention = 24 * time.Hour
+	maxFinishedJobs      = 100
+)
+
+// JobRequest is what clients send to analyse a release.
+type JobRequest struct {
+	Path                 string   `json:"path"`
+	Snatched             bool     `json:"snatched"`
+	DisableSpecs         bool     `json:"no_specs"`
+	DisableCombinedSpecs bool     `json:"no_overview"`
+	SpectrogramBackend   string   `json:"spectrograms"`
+	DisabledChecks       []string `json:"disable"`
+	Manifest             bool     `json:"manifest"`
+	DisableCache         bool     `json:"no_cache"`
+	Source               string   `json:"source"`
+}
+
+func (r JobRequest) check() error {
+	if r.Path == "" || !fs.DirExists(r.Path) {
+		return errors.New("target path " + r.Path + " not found")
+	}
+	if r.SpectrogramBackend != "" && !strslice.Contains(SpectrogramBackends, r.SpectrogramBackend) {
+		return errors.New("unknown spectrogram backend " + r.SpectrogramBackend)
+	}
+	if r.Source != "" && !strslice.Contains(Sources, r.Source) {
+		return errors.New("unknown source " + r.Source)
+	}
+	for _, c := range r.DisabledChecks {
+		if !strslice.Contains(OptionalChecks, c) {
+			return errors.New("unknown check " + c + ", cannot disable it")
+		}
+	}
+	return nil
+}
+
+// Job is an analysis submitted to the server.
+type Job struct {
+	ID          string     `json:"id"`
+	Request     JobRequest `json:"request"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Summary     string     `json:"summary,omitempty"`
+	Submitted   time.Time  `json:"submitted"`
+	Started     *time.Time `json:"started,omitempty"`
+	Finished    *time.Time `json:"finished,omitempty"`
+	metadataDir string
+	report      string
+}
+
+// Server runs analysis jobs submitted over HTTP, one at a time.
+type Server struct {
+	options Options
+	version string
+	queue   chan *Job
+	jobs    map[string]*Job
+	lastID  int
+	mutex   sync.RWMutex
+}
+
+// NewServer using options for all jobs, except for what is set by each job request.
+func NewServer(options Options, version string) *Server {
+	return &Server{options: options, version: version, queue: make(chan *Job, jobQueueSize), jobs: make(map[string]*Job)}
+}
+
+// Serve on listen address. Jobs run one at a time, since analyses share the same logger, which is redirected to the
+// report of the running job.
+func (s *Server) Serve(listen string) error {
+	go s.work()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+	logthis.Info(ui.YellowBold(ArrowHeader+"Listening on "+listen), logthis.NORMAL)
+	return http.ListenAndServe(listen, mux)
+}
+
+// pruneJobs that finished a long time ago, and the oldest finished jobs if there are too many.
+// The server mutex must be locked.
+func (s *Server) pruneJobs() {
+	var finished []*Job
+	for id, j := range s.jobs {
+		switch {
+		case j.Finished == nil:
+			continue
+		case time.Since(*j.Finished) > finishedJobRetention:
+			delete(s.jobs, id)
+		default:
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Finished.After(*finished[j].Finished) })
+	for _, j := range finished[maxFinishedJobs:] {
+		delete(s.jobs, j.ID)
+	}
+}
+
+func (s *Server) work() {
+	for job := range s.queue {
+		s.mutex.Lock()
+		job.Status = JobRunning
+		started := time.Now()
+		job.Started = &started
+		s.mutex.Unlock()
+
+		options := s.options
+		options.Snatched = job.Request.Snatched
+		options.DisableSpecs = job.Request.DisableSpecs
+		options.DisableCombinedSpecs = job.Request.DisableCombinedSpecs
+		options.DisabledChecks = job.Request.DisabledChecks
+		options.Manifest = job.Request.Manifest
+		options.DisableCache = job.Request.DisableCache
+		options.Source = job.Request.Source
+		if job.Request.SpectrogramBackend != "" {
+			options.SpectrogramBackend = job.Request.SpectrogramBackend
+		}
+		options.JSONOutput = false
+		options.StdOutput = false
+		if options.Snatched {
+			options.MetadataRoot = ""
+		}
+		analysis, _, err := Run(job.Request.Path, options, s.version)
+		analysis.ToggleStdOutput(true)
+
+		s.mutex.Lock()
+		finished := time.Now()
+		job.Finished = &finished
+		job.metadataDir = MetadataDir(job.Request.Path, options.MetadataRoot, options.Snatched)
+		job.report = analysis.JSONOutput()
+		job.Summary = analysis.Summary()
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = JobDone
+		}
+		s.pruneJobs()
+		s.mutex.Unlock()
+		logthis.Info(fmt.Sprintf("Job %s for %s: %s", job.ID, job.Request.Path, job.Summary), logthis.NORMAL)
+	}
+}
+
+// handleJobs lists jobs (GET) or submits a new one (POST).
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mutex.RLock()
+		jobs := make([]*Job, 0, len(s.jobs))
+		for _, j := range s.jobs {
+			jobs = append(jobs, j)
+		}
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Submitted.Before(jobs[j].Submitted) })
+		writeJSON(w, http.StatusOK, jobs)
+		s.mutex.RUnlock()
+	case http.MethodPost:
+		var request JobRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "could not read job request"))
+			return
+		}
+		request.Path = filepath.Clean(request.Path)
+		if err := request.check(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.lastID++
+		job := &Job{ID: strconv.Itoa(s.lastID), Request: request, Status: JobQueued, Submitted: time.Now()}
+		select {
+		case s.queue <- job:
+			s.jobs[job.ID] = job
+			writeJSON(w, http.StatusAccepted, job)
+		default:
+			writeError(w, http.StatusServiceUnavailable, errors.New("too many jobs waiting, try again later"))
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleJob serves a job status, its report, or its spectrograms:
+// /jobs/<ID>, /jobs/<ID>/report, /jobs/<ID>/spectrograms, /jobs/<ID>/spectrograms/<FILE>.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/"), "/")
+	s.mutex.RLock()
+	job, ok := s.jobs[parts[0]]
+	var status, report, metadataDir string
+	if ok {
+		status, report, metadataDir = job.Status, job.report, job.metadataDir
+	}
+	s.mutex.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("unknown job "+parts[0]))
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.mutex.RLock()
+		writeJSON(w, http.StatusOK, job)
+		s.mutex.RUnlock()
+	case status != JobDone && status != JobFailed:
+		writeError(w, http.StatusConflict, errors.New("job "+job.ID+" is "+status))
+	case len(parts) == 2 && parts[1] == "report":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, report)
+	case len(parts) == 2 && parts[1] == "spectrograms":
+		writeJSON(w, http.StatusOK, listSpectrograms(metadataDir))
+	case len(parts) == 3 && parts[1] == "spectrograms" && strslice.Contains(listSpectrograms(metadataDir), parts[2]):
+		http.ServeFile(w, r, filepath.Join(metadataDir, parts[2]))
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// writeJSON response. Errors are not logged: they only mean the client is gone, and handlers must not use the logger
+// while it is redirected to the report of the running job.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,34 @@
+package propolis
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneJobs(t *testing.T) {
+	fmt.Println("+ Testing pruneJobs...")
+	check := assert.New(t)
+
+	s := NewServer(Options{}, "test")
+	now := time.Now()
+	old := now.Add(-2 * finishedJobRetention)
+	s.jobs["old"] = &Job{ID: "old", Status: JobDone, Finished: &old}
+	s.jobs["queued"] = &Job{ID: "queued", Status: JobQueued}
+	for i := 0; i < maxFinishedJobs+5; i++ {
+		finished := now.Add(-time.Duration(i) * time.Minute)
+		id := strconv.Itoa(i)
+		s.jobs[id] = &Job{ID: id, Status: JobFailed, Finished: &finished}
+	}
+	s.pruneJobs()
+
+	check.Equal(maxFinishedJobs+1, len(s.jobs))
+	check.NotContains(s.jobs, "old")
+	check.Contains(s.jobs, "queued")
+	check.Contains(s.jobs, "0")
+	check.Contains(s.jobs, strconv.Itoa(maxFinishedJobs-1))
+	check.NotContains(s.jobs, strconv.Itoa(maxFinishedJobs))
+}
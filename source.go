@@ -0,0 +1,151 @@
+package propolis
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+// sources, as in Gazelle upload forms.
+const (
+	sourceCD       = "CD"
+	sourceWEB      = "WEB"
+	sourceVinyl    = "Vinyl"
+	sourceSACD     = "SACD"
+	sourceDAT      = "DAT"
+	sourceCassette = "Cassette"
+	sourceUnknown  = "Unknown"
+
+	cdBitDepth   = 16
+	cdSampleRate = 44100
+)
+
+var (
+	// Sources that can be declared with --source.
+	Sources = []string{sourceCD, sourceWEB, sourceVinyl, sourceSACD, sourceDAT, sourceCassette}
+
+	// sources that can be recognized in folder names, by word.
+	folderNameSources = map[string]string{
+		"sacd":     sourceSACD,
+		"dat":      sourceDAT,
+		"cassette": sourceCassette,
+		"tape":     sourceCassette,
+		"vinyl":    sourceVinyl,
+		"lp":       sourceVinyl,
+		"web":      sourceWEB,
+		"cd":       sourceCD,
+	}
+	// analog sources need their lineage (equipment, software) described in a text file.
+	analogSources = []string{sourceVinyl, sourceCassette}
+	// rip files make a release without a source in its folder name a CD rip.
+	ripExtensions = []string{".log", ".cue"}
+	// logs saved by propolis, see SaveOuput.
+	propolisLogName = regexp.MustCompile(`^propolis(_.+)?\.log$`)
+
+	folderNameWords = regexp.MustCompile(`[a-z0-9]+`)
+	// A1, B12...
+	sideTrackNumber = regexp.MustCompile(`^[A-Z][0-9]+$`)
+	sideFilename    = regexp.MustCompile(`^[A-Za-z][0-9]+\b`)
+)
+
+// ripFiles are the .log and .cue files found in a release, except the ones propolis generated.
+func ripFiles(path string) []string {
+	var files []string
+	for _, f := range fs.GetAllowedFilesByExt(path, ripExtensions) {
+		if !propolisLogName.MatchString(filepath.Base(f)) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// guessSource from the folder name and rip files. Sources other than CD are only found in the folder name, and are
+// preferred to the rip files since vinyl rips sometimes come with a cue.
+func guessSource(path string) string {
+	fromName := sourceUnknown
+	// the source is usually mentioned last, after the title
+	for _, w := range folderNameWords.FindAllString(strings.ToLower(filepath.Base(path)), -1) {
+		if s, ok := folderNameSources[w]; ok {
+			fromName = s
+		}
+	}
+	switch {
+	case fromName != sourceUnknown && fromName != sourceWEB && fromName != sourceCD:
+		return fromName
+	case len(ripFiles(path)) != 0:
+		return sourceCD
+	default:
+		return fromName
+	}
+}
+
+// SetSource of the release, guessed from its files if empty.
+func (p *Propolis) SetSource(source string) {
+	p.declaredSource = source
+}
+
+// source of the release, as declared or guessed.
+func (p *Propolis) source() string {
+	if p.declaredSource != "" {
+		return p.declaredSource
+	}
+	return guessSource(p.release.Path)
+}
+
+// lineageFiles are the text files of the release, outside the metadata folder.
+func lineageFiles(path, metadataDir string) []string {
+	var files []string
+	for _, f := range fs.GetAllowedFilesByExt(path, []string{".txt"}) {
+		if !strings.HasPrefix(f, metadataDir+string(filepath.Separator)) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// sideNumbered if track numbers use vinyl sides: A1, A2, B1...
+func (p *Propolis) sideNumbered() bool {
+	if len(p.release.Flacs) == 0 {
+		return false
+	}
+	for _, f := range p.release.Flacs {
+		if !sideTrackNumber.MatchString(strings.ToUpper(f.CommonTags().TrackNumber)) && !sideFilename.MatchString(filepath.Base(f.Path)) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckSource applies the rules of the source of the release, and compares the declared source with what was detected.
+func (p *Propolis) CheckSource(metadataDir string) {
+	source, detected := p.source(), guessSource(p.release.Path)
+	if p.declaredSource == "" {
+		p.ConditionCheck(LevelInfo, internalRule, fmt.Sprintf(OKSourceDetected, detected), KOSourceDetected, detected != sourceUnknown)
+	} else {
+		p.ConditionCheck(LevelWarning, internalRule, fmt.Sprintf(OKSourceDeclared, source), fmt.Sprintf(KOSourceDeclared, source, detected), detected == sourceUnknown || detected == source)
+	}
+
+	switch {
+	case source == sourceCD:
+		var notCD []string
+		for _, f := range p.release.Flacs {
+			if f.BitDepth != cdBitDepth || f.SampleRate != cdSampleRate {
+				notCD = append(notCD, fmt.Sprintf("%s: %dbit/%gkHz", filepath.Base(f.Path), f.BitDepth, float64(f.SampleRate)/1000))
+			}
+		}
+		p.ListCheck(LevelCritical, "2.1.1", OKSourceCDSpecs, KOSourceCDSpecs, notCD)
+		var logs []string
+		for _, r := range ripFiles(p.release.Path) {
+			if strings.EqualFold(filepath.Ext(r), ".log") {
+				logs = append(logs, r)
+			}
+		}
+		p.ConditionCheck(LevelWarning, "2.2.10", OKSourceCDLog, KOSourceCDLog, len(logs) != 0)
+	case strslice.Contains(analogSources, source):
+		p.ConditionCheck(LevelCritical, internalRule, fmt.Sprintf(OKSourceLineage, source), fmt.Sprintf(KOSourceLineage, source), len(lineageFiles(p.release.Path, metadataDir)) != 0)
+	}
+}
@@ -0,0 +1,58 @@
+package propolis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuessSource(t *testing.T) {
+	fmt.Println("+ Testing guessSource...")
+	check := assert.New(t)
+
+	cases := []struct {
+		folder   string
+		ripFiles []string
+		expected string
+	}{
+		{"Artist - Album (2020) [FLAC]", nil, sourceUnknown},
+		{"Artist - Album (2020) [WEB FLAC]", nil, sourceWEB},
+		{"Artist - Album (2020) [CD FLAC]", nil, sourceCD},
+		{"Artist - Album (2020) [FLAC]", []string{"Artist - Album.log"}, sourceCD},
+		{"Artist - Album (2020) [FLAC]", []string{"CD1/Album.cue"}, sourceCD},
+		// rip files are more reliable than a WEB in the folder name
+		{"Artist - Album (2020) [WEB FLAC]", []string{"Album.log"}, sourceCD},
+		// vinyl rips sometimes come with a cue
+		{"Artist - Album (2020) [Vinyl 24-96]", []string{"Side A.cue"}, sourceVinyl},
+		{"Artist - Album (2020) [LP FLAC]", nil, sourceVinyl},
+		{"Artist - Album (1985) [Tape FLAC]", nil, sourceCassette},
+		{"Artist - Album (1985) [Cassette FLAC]", nil, sourceCassette},
+		{"Artist - Album (2003) [SACD 24-88]", nil, sourceSACD},
+		{"Artist - Album (1992) [DAT]", nil, sourceDAT},
+		// only whole words
+		{"Webern - Symphony (1990) [FLAC]", nil, sourceUnknown},
+		{"Artist - Help (1965) [FLAC]", nil, sourceUnknown},
+		// the source is usually mentioned last
+		{"CD Kid - Album (2020) [WEB]", nil, sourceWEB},
+		// propolis logs are not rip logs
+		{"Artist - Album (2020) [FLAC]", []string{"Metadata/propolis.log"}, sourceUnknown},
+		{"Artist - Album (2020) [FLAC]", []string{"Metadata/propolis_v1.2.3.log"}, sourceUnknown},
+		// but rip logs can mention propolis
+		{"Propolis - Album (2020) [FLAC]", []string{"Propolis - Album.log"}, sourceCD},
+		{"Propolis - Album (2020) [FLAC]", []string{"propolis.cue"}, sourceCD},
+		{"Artist - Album (2020) [FLAC]", []string{"CD1/propolis (disc 1).log"}, sourceCD},
+	}
+	for i, c := range cases {
+		path := filepath.Join(t.TempDir(), c.folder)
+		check.Nil(os.MkdirAll(path, 0777))
+		for _, f := range c.ripFiles {
+			check.Nil(os.MkdirAll(filepath.Join(path, filepath.Dir(f)), 0777))
+			check.Nil(ioutil.WriteFile(filepath.Join(path, f), []byte("rip"), 0600))
+		}
+		check.Equal(c.expected, guessSource(path), fmt.Sprintf("%d: %s", i, c.folder))
+	}
+}
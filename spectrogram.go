@@ -0,0 +1,487 @@
+package propolis
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	mflac "github.com/mewkiz/flac"
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/music"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// SpectrogramsNative generates spectrograms without any external dependency.
+	SpectrogramsNative = "native"
+	// SpectrogramsSox generates spectrograms with sox.
+	SpectrogramsSox = "sox"
+
+	// same dimensions and dynamic range as the sox spectrograms.
+	spectrogramWidth        = 1710
+	spectrogramHeight       = 855
+	spectrogramRange        = 120
+	spectrogramMarginLeft   = 60
+	spectrogramMarginRight  = 90
+	spectrogramMarginTop    = 40
+	spectrogramMarginBottom = 30
+	sliceSeconds            = 10
+	sliceWidth              = 250
+	sliceHeight             = 855
+)
+
+// SpectrogramBackends that can be used to generate spectrograms.
+var SpectrogramBackends = []string{SpectrogramsNative, SpectrogramsSox}
+
+// spectrogram of the first channel of a track, in dB below full scale.
+type spectrogram struct {
+	sampleRate uint32
+	seconds    float64
+	// columns from left to right, rows from lowest to highest frequency.
+	columns [][]float64
+}
+
+// computeSpectrogram of a section of a track, starting at from seconds and lasting for length seconds (0 for the whole track).
+// Each column is the average power of as many consecutive windows as the samples it covers.
+func computeSpectrogram(path string, from, length float64, width, height int) (*spectrogram, error) {
+	stream, err := mflac.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if stream.Info.NSamples == 0 {
+		return nil, errors.New("unknown number of samples in " + filepath.Base(path))
+	}
+
+	// section to analyse, in samples
+	rate := float64(stream.Info.SampleRate)
+	start := uint64(math.Max(0, from*rate))
+	if start >= stream.Info.NSamples {
+		start = 0
+	}
+	end := stream.Info.NSamples
+	if length > 0 && start+uint64(length*rate) < end {
+		end = start + uint64(length*rate)
+	}
+	s := &spectrogram{sampleRate: stream.Info.SampleRate, seconds: float64(end-start) / rate}
+
+	fftSize := 256
+	for fftSize < 2*height {
+		fftSize *= 2
+	}
+	window, windowSum := kaiserWindow(fftSize, 0.1102*(spectrogramRange-8.7))
+	scale := float64(int64(1) << (stream.Info.BitsPerSample - 1))
+
+	// windows used for each column, as absolute sample positions
+	blocks := make([][]int64, width)
+	for x := 0; x < width; x++ {
+		s0 := int64(start) + int64(x)*int64(end-start)/int64(width)
+		s1 := int64(start) + int64(x+1)*int64(end-start)/int64(width)
+		if s1-s0 < int64(fftSize) {
+			blocks[x] = []int64{(s0+s1)/2 - int64(fftSize)/2}
+			continue
+		}
+		for b := s0; b+int64(fftSize) <= s1; b += int64(fftSize) {
+			blocks[x] = append(blocks[x], b)
+		}
+	}
+
+	// only keeping the decoded samples still needed by the next columns
+	var buffer []float64
+	var bufferStart, decoded int64
+	var eof bool
+	bins := make([]complex128, fftSize)
+	for x := 0; x < width; x++ {
+		last := blocks[x][len(blocks[x])-1] + int64(fftSize)
+		for !eof && decoded < last {
+			fr, err := stream.ParseNext()
+			if err == io.EOF {
+				eof = true
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(buffer) == 0 {
+				bufferStart = decoded
+				if blocks[x][0] > decoded {
+					bufferStart = blocks[x][0]
+				}
+			}
+			for i, sample := range fr.Subframes[0].Samples {
+				if decoded+int64(i) >= bufferStart {
+					buffer = append(buffer, float64(sample)/scale)
+				}
+			}
+			decoded += int64(fr.BlockSize)
+		}
+
+		power := make([]float64, fftSize/2+1)
+		for _, b := range blocks[x] {
+			for i := range bins {
+				var v float64
+				if j := b + int64(i) - bufferStart; j >= 0 && j < int64(len(buffer)) {
+					v = buffer[j]
+				}
+				bins[i] = complex(v*window[i], 0)
+			}
+			fft(bins)
+			for k := range power {
+				power[k] += real(bins[k])*real(bins[k]) + imag(bins[k])*imag(bins[k])
+			}
+		}
+
+		column := make([]float64, height)
+		for y := range column {
+			// loudest bin in the frequency range covered by this row
+			var amplitude float64
+			first, last := y*len(power)/height, (y+1)*len(power)/height
+			if last == first {
+				last++
+			}
+			for k := first; k < last; k++ {
+				amplitude = math.Max(amplitude, math.Sqrt(power[k]/float64(len(blocks[x]))))
+			}
+			column[y] = math.Max(-spectrogramRange, math.Min(0, 20*math.Log10(2*amplitude/windowSum+1e-12)))
+		}
+		s.columns = append(s.columns, column)
+
+		if x+1 < width && blocks[x+1][0] > bufferStart {
+			drop := blocks[x+1][0] - bufferStart
+			if drop > int64(len(buffer)) {
+				drop = int64(len(buffer))
+			}
+			buffer = buffer[drop:]
+			bufferStart += drop
+		}
+	}
+	return s, nil
+}
+
+// kaiserWindow of size n, returned with the sum of its coefficients.
+func kaiserWindow(n int, beta float64) ([]float64, float64) {
+	w := make([]float64, n)
+	var sum float64
+	for i := range w {
+		r := 2*float64(i)/float64(n-1) - 1
+		w[i] = besselI0(beta*math.Sqrt(1-r*r)) / besselI0(beta)
+		sum += w[i]
+	}
+	return w, sum
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > 1e-12*sum; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+// fft in place, len(a) must be a power of 2.
+func fft(a []complex128) {
+	n := len(a)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for i := 0; i < n; i += size {
+			w := complex(1, 0)
+			for j := 0; j < size/2; j++ {
+				u, v := a[i+j], a[i+j+size/2]*w
+				a[i+j], a[i+j+size/2] = u+v, u-v
+				w *= step
+			}
+		}
+	}
+}
+
+// spectrogramColor for a level in dB, using the default sox palette.
+func spectrogramColor(dB float64) color.RGBA {
+	c := 1 + dB/spectrogramRange
+	var r, g, b float64
+	switch {
+	case c < .13:
+	case c < .73:
+		r = math.Sin((c - .13) / .60 * math.Pi / 2)
+	default:
+		r = 1
+	}
+	switch {
+	case c < .6:
+	case c < .91:
+		g = math.Sin((c - .6) / .31 * math.Pi / 2)
+	default:
+		g = 1
+	}
+	switch {
+	case c < .6:
+		b = .5 * math.Sin(c/.6*math.Pi)
+	case c < .78:
+	default:
+		b = (c - .78) / .22
+	}
+	return color.RGBA{R: uint8(255 * r), G: uint8(255 * g), B: uint8(255 * b), A: 255}
+}
+
+func drawText(img *image.RGBA, x, y int, text string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(color.White),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)},
+	}
+	d.DrawString(text)
+}
+
+func savePNG(img image.Image, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// renderSpectrogram with axes, title and a dB scale, similar to what sox generates.
+func renderSpectrogram(s *spectrogram, title, comment string) *image.RGBA {
+	plotHeight := spectrogramHeight - spectrogramMarginTop - spectrogramMarginBottom
+	img := image.NewRGBA(image.Rect(0, 0, spectrogramMarginLeft+spectrogramWidth+spectrogramMarginRight, spectrogramHeight))
+	for i := range img.Pix {
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	for x, column := range s.columns {
+		for y := 0; y < plotHeight; y++ {
+			img.SetRGBA(spectrogramMarginLeft+x, spectrogramMarginTop+plotHeight-1-y, spectrogramColor(column[y*len(column)/plotHeight]))
+		}
+	}
+	drawText(img, spectrogramMarginLeft+spectrogramWidth/2-len(title)*7/2, spectrogramMarginTop-15, title)
+	drawText(img, 5, spectrogramHeight-8, comment)
+
+	// frequency axis, every 2kHz
+	nyquist := float64(s.sampleRate) / 2
+	for f := 0.0; f <= nyquist; f += 2000 {
+		y := spectrogramMarginTop + plotHeight - 1 - int(f/nyquist*float64(plotHeight-1))
+		for x := spectrogramMarginLeft - 5; x < spectrogramMarginLeft; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+		drawText(img, spectrogramMarginLeft-40, y+4, fmt.Sprintf("%3.0fk", f/1000))
+	}
+	// time axis, with at most 20 ticks
+	step := 1.0
+	for _, candidate := range []float64{1, 2, 5, 10, 15, 30, 60, 120, 300, 600} {
+		step = candidate
+		if s.seconds/candidate <= 20 {
+			break
+		}
+	}
+	for t := 0.0; t <= s.seconds; t += step {
+		x := spectrogramMarginLeft + int(t/s.seconds*float64(spectrogramWidth-1))
+		for y := spectrogramMarginTop + plotHeight; y < spectrogramMarginTop+plotHeight+5; y++ {
+			img.SetRGBA(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+		drawText(img, x-14, spectrogramMarginTop+plotHeight+18, fmt.Sprintf("%d:%02d", int(t)/60, int(t)%60))
+	}
+	// dB scale
+	for y := 0; y < plotHeight; y++ {
+		c := spectrogramColor(-spectrogramRange * (1 - float64(y)/float64(plotHeight-1)))
+		for x := 0; x < 15; x++ {
+			img.SetRGBA(spectrogramMarginLeft+spectrogramWidth+15+x, spectrogramMarginTop+plotHeight-1-y, c)
+		}
+	}
+	for dB := 0; dB <= spectrogramRange; dB += 20 {
+		y := spectrogramMarginTop + int(float64(dB)/spectrogramRange*float64(plotHeight-1))
+		drawText(img, spectrogramMarginLeft+spectrogramWidth+35, y+4, fmt.Sprintf("-%ddB", dB))
+	}
+	return img
+}
+
+// renderRawSpectrogram without any axis or legend.
+func renderRawSpectrogram(s *spectrogram) *image.RGBA {
+	height := len(s.columns[0])
+	img := image.NewRGBA(image.Rect(0, 0, len(s.columns), height))
+	for x, column := range s.columns {
+		for y, dB := range column {
+			img.SetRGBA(x, height-1-y, spectrogramColor(dB))
+		}
+	}
+	return img
+}
+
+// generateNativeSpectrograms for all tracks, jobs at a time, returning the first error encountered.
+func generateNativeSpectrograms(release *music.Release, title string, jobs int, generateSlices bool) error {
+	if err := os.MkdirAll(release.MetadataPath, 0777); err != nil {
+		return err
+	}
+	errs := make([]error, len(release.Flacs))
+	runInParallel(jobs, len(release.Flacs), func(i int) {
+		errs[i] = generateNativeSpectrogram(release, i, title, generateSlices)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateNativeSpectrogram of the full track, and optionally of a slice for the overview.
+func generateNativeSpectrogram(release *music.Release, i int, title string, generateSlice bool) error {
+	path := release.Flacs[i].Path
+	fullName := spectrogramPath(release.MetadataPath, path)
+	if !fs.FileExists(fullName) {
+		s, err := computeSpectrogram(path, 0, 0, spectrogramWidth, spectrogramHeight-spectrogramMarginTop-spectrogramMarginBottom)
+		if err != nil {
+			return errors.Wrap(err, "could not generate spectrogram for "+filepath.Base(path))
+		}
+		if err := savePNG(renderSpectrogram(s, filepath.Base(path), title), fullName); err != nil {
+			return err
+		}
+	}
+	if !generateSlice {
+		return nil
+	}
+	// slice centered around the middle of the song, used to build the overview.
+	sliceName := spectrogramSlicePath(release.MetadataPath, i)
+	if fs.FileExists(sliceName) {
+		return nil
+	}
+	duration := float64(release.Flacs[i].DurationSeconds)
+	s, err := computeSpectrogram(path, duration/2-sliceSeconds/2, sliceSeconds, sliceWidth, sliceHeight)
+	if err != nil {
+		return errors.Wrap(err, "could not generate spectrogram slice for "+filepath.Base(path))
+	}
+	return savePNG(renderRawSpectrogram(s), sliceName)
+}
+
+// generateSoxSpectrograms for all tracks with sox, jobs at a time, returning the first error encountered.
+// The same sox commands as assistance are used, so that the spectrograms and slices it would skip are identical.
+func generateSoxSpectrograms(release *music.Release, title string, jobs int, generateSlices bool) error {
+	if err := os.MkdirAll(release.MetadataPath, 0777); err != nil {
+		return err
+	}
+	errs := make([]error, len(release.Flacs))
+	runInParallel(jobs, len(release.Flacs), func(i int) {
+		f := release.Flacs[i]
+		if fullName := spectrogramPath(release.MetadataPath, f.Path); !fs.FileExists(fullName) {
+			cmd := exec.Command("sox", f.Path, "-n", "remix", "1", "spectrogram", "-x", strconv.Itoa(spectrogramWidth), "-Y", strconv.Itoa(spectrogramHeight), "-z", strconv.Itoa(spectrogramRange), "-w", "Kaiser", "-t", filepath.Base(f.Path), "-c", title, "-o", fullName)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				errs[i] = errors.Wrap(err, "could not generate spectrogram for "+filepath.Base(f.Path)+": "+strings.TrimSpace(string(output)))
+				return
+			}
+		}
+		sliceName := spectrogramSlicePath(release.MetadataPath, i)
+		if !generateSlices || fs.FileExists(sliceName) {
+			return
+		}
+		// slice centered around the middle of the song, or the whole song if it is too short
+		args := []string{f.Path, "-n", "remix", "1", "spectrogram", "-r", "-x", strconv.Itoa(sliceWidth), "-y", strconv.Itoa(sliceHeight), "-z", strconv.Itoa(spectrogramRange), "-w", "Kaiser"}
+		if f.DurationSeconds >= sliceSeconds {
+			start := int(f.DurationSeconds/2 - sliceSeconds/2)
+			args = append(args, "-S", fmt.Sprintf("%d:%02d", start/60, start%60), "-d", fmt.Sprintf("0:%02d", sliceSeconds))
+		}
+		if output, err := exec.Command("sox", append(args, "-o", sliceName)...).CombinedOutput(); err != nil {
+			errs[i] = errors.Wrap(err, "could not generate spectrogram slice for "+filepath.Base(f.Path)+": "+strings.TrimSpace(string(output)))
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spectrogramPath of the full spectrogram of a track, named the same way by both backends.
+func spectrogramPath(metadataDir, track string) string {
+	return filepath.Join(metadataDir, strings.TrimSuffix(filepath.Base(track), filepath.Ext(track))+".spectral.full.png")
+}
+
+// spectrogramSlicePath of the slice of the i-th track, used to build the overview.
+func spectrogramSlicePath(metadataDir string, i int) string {
+	return filepath.Join(metadataDir, strconv.Itoa(i+1)+"_zoom.png")
+}
+
+// restoreSpectrograms of unchanged tracks from the cache, if they were generated in another metadata folder, for
+// example before the release folder was renamed. Full spectrograms show the track file name, so they are only reused
+// if it did not change. The slices used for the overview are removed once it is generated, so they are not cached.
+func (p *Propolis) restoreSpectrograms() {
+	if p.cache == nil {
+		return
+	}
+	if err := os.MkdirAll(p.release.MetadataPath, 0777); err != nil {
+		return
+	}
+	for _, f := range p.release.Flacs {
+		cached := p.cache.get(f)
+		if cached == nil {
+			continue
+		}
+		// the spectrograms that cannot be copied will just be generated again
+		full := spectrogramPath(p.release.MetadataPath, f.Path)
+		if cached.Spectrogram != "" && filepath.Base(cached.Spectrogram) == filepath.Base(full) && !fs.FileExists(full) && fs.FileExists(cached.Spectrogram) {
+			_ = fs.CopyFile(cached.Spectrogram, full, false)
+		}
+	}
+}
+
+// cacheSpectrograms generated for each track, so that they can be restored.
+func (p *Propolis) cacheSpectrograms() {
+	if p.cache == nil {
+		return
+	}
+	metadataDir, err := filepath.Abs(p.release.MetadataPath)
+	if err != nil {
+		return
+	}
+	for _, f := range p.release.Flacs {
+		full := spectrogramPath(metadataDir, f.Path)
+		p.cache.update(f, func(t *cachedTrack) {
+			if fs.FileExists(full) {
+				t.Spectrogram = full
+			}
+		})
+	}
+}
+
+// listSpectrograms found in a metadata folder.
+func listSpectrograms(metadataDir string) []string {
+	images := []string{}
+	entries, err := os.ReadDir(metadataDir)
+	if err != nil {
+		return images
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.ToLower(filepath.Ext(e.Name())) == ".png" {
+			images = append(images, e.Name())
+		}
+	}
+	return images
+}
@@ -0,0 +1,90 @@
+package propolis
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFFT(t *testing.T) {
+	fmt.Println("+ Testing fft...")
+	check := assert.New(t)
+
+	// a sine falling exactly on a bin
+	n, k0 := 1024, 37
+	a := make([]complex128, n)
+	for i := range a {
+		a[i] = complex(math.Sin(2*math.Pi*float64(k0*i)/float64(n)), 0)
+	}
+	fft(a)
+	for k := 0; k <= n/2; k++ {
+		if k == k0 {
+			check.InDelta(float64(n)/2, cmplx.Abs(a[k]), 1e-6)
+		} else {
+			check.InDelta(0, cmplx.Abs(a[k]), 1e-6, k)
+		}
+	}
+
+	// same result as a naive DFT
+	n = 64
+	a, dft := make([]complex128, n), make([]complex128, n)
+	for i := range a {
+		a[i] = complex(float64(noise(0, i)), float64(noise(1, i)))
+	}
+	for k := range dft {
+		for i, v := range a {
+			dft[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(k*i)/float64(n)))
+		}
+	}
+	fft(a)
+	for k := range a {
+		check.InDelta(0, cmplx.Abs(a[k]-dft[k]), 1e-6*cmplx.Abs(dft[k])+1e-6, k)
+	}
+}
+
+func TestComputeSpectrogram(t *testing.T) {
+	fmt.Println("+ Testing computeSpectrogram...")
+	check := assert.New(t)
+
+	// a 5kHz sine at half of full scale (-6dB), on the left channel only
+	frequency := 5000.0
+	path := filepath.Join(t.TempDir(), "sine.flac")
+	writeTestFlac(t, path, 2, testSampleRate, func(channel, i int) int32 {
+		if channel != 0 {
+			return 0
+		}
+		return int32(math.Round(16384 * math.Sin(2*math.Pi*frequency*float64(i)/testSampleRate)))
+	})
+
+	width, height := 40, 200
+	s, err := computeSpectrogram(path, 0, 0, width, height)
+	check.Nil(err)
+	check.Equal(uint32(testSampleRate), s.sampleRate)
+	check.InDelta(1.0, s.seconds, 1e-9)
+	check.Equal(width, len(s.columns))
+	rowHertz := float64(testSampleRate) / 2 / float64(height)
+	for x, column := range s.columns {
+		check.Equal(height, len(column))
+		loudest := 0
+		for y := range column {
+			if column[y] > column[loudest] {
+				loudest = y
+			}
+		}
+		check.InDelta(frequency, (float64(loudest)+0.5)*rowHertz, 2*rowHertz, x)
+		check.InDelta(-6, column[loudest], 1, x)
+		// far from the sine, only the window leakage and quantization noise remain
+		check.Less(column[loudest/2], -80.0, x)
+		check.Less(column[height-1], -80.0, x)
+	}
+
+	// a section of the track
+	s, err = computeSpectrogram(path, 0.5, 0.25, 10, height)
+	check.Nil(err)
+	check.InDelta(0.25, s.seconds, 1e-3)
+	check.Equal(10, len(s.columns))
+}
@@ -0,0 +1,193 @@
+package propolis
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/strslice"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	regexpURL = `(?i)(https?://|www\.)\S+`
+)
+
+var (
+	// common alternative spellings of standard Vorbis comment field names.
+	nonCanonicalFieldNames = map[string]string{
+		"ALBUM ARTIST": flac.TagAlbumArtist,
+		"ALBUM_ARTIST": flac.TagAlbumArtist,
+		"ALBUM-ARTIST": flac.TagAlbumArtist,
+		"TRACK":        flac.TagTrackNumber,
+		"TRACK NUMBER": flac.TagTrackNumber,
+		"TRACK_NUMBER": flac.TagTrackNumber,
+		"DISC":         flac.TagDiscNumber,
+		"DISC NUMBER":  flac.TagDiscNumber,
+		"DISC_NUMBER":  flac.TagDiscNumber,
+		"TOTAL TRACKS": flac.TagTrackTotal,
+		"TOTAL DISCS":  flac.TagDiscTotal,
+		"RECORD LABEL": flac.TagRecordLabel2,
+		"PUBLISHER":    flac.TagRecordLabel2,
+	}
+	// fields left behind by rippers and taggers, which have no place in an upload.
+	taggerCruftFields = []string{"ENCODEDBY", "ENCODED BY", "ENCODED-BY", "ENCODED_BY", "RIPPER", "TAGGEDBY", "TAGGED BY", "ITUNNORM", "ITUNSMPB", "ITUNES_CDDB_1"}
+	// fields where URLs are usually leftover advertising.
+	taggerCruftURLFields = []string{"COMMENT", "DESCRIPTION", flac.TagContact}
+	// fields where line breaks and tabs are expected.
+	multiLineFields = []string{"COMMENT", "DESCRIPTION", "LYRICS", "UNSYNCEDLYRICS"}
+)
+
+// rawTag is a single FIELD=value Vorbis comment, as found in a track.
+type rawTag struct {
+	track string
+	field string
+	value string
+}
+
+func (t rawTag) String() string {
+	return fmt.Sprintf("%s: %s=%q", t.track, t.field, t.value)
+}
+
+// getRawTags of all tracks, sorted by track and field name so that results are deterministic.
+func getRawTags(flacs []*flac.Flac) []rawTag {
+	var tags []rawTag
+	for _, f := range flacs {
+		raw := f.RawTags()
+		fields := make([]string, 0, len(raw))
+		for k := range raw {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		for _, k := range fields {
+			for _, v := range raw[k] {
+				tags = append(tags, rawTag{track: filepath.Base(f.Path), field: k, value: v})
+			}
+		}
+	}
+	return tags
+}
+
+func filterRawTags(tags []rawTag, hasProblem func(t rawTag) bool) []string {
+	var problems []string
+	for _, t := range tags {
+		if hasProblem(t) {
+			problems = append(problems, t.String())
+		}
+	}
+	return problems
+}
+
+// findTagsWithExtraWhitespace returns the tags with leading or trailing whitespace in their values.
+func findTagsWithExtraWhitespace(flacs []*flac.Flac) []string {
+	return filterRawTags(getRawTags(flacs), func(t rawTag) bool {
+		return t.value != "" && strings.TrimSpace(t.value) != t.value
+	})
+}
+
+// findEmptyTags returns the tags without any actual value.
+func findEmptyTags(flacs []*flac.Flac) []string {
+	return filterRawTags(getRawTags(flacs), func(t rawTag) bool {
+		return strings.TrimSpace(t.value) == ""
+	})
+}
+
+// findDuplicateTags returns the tags which appear more than once, with the same value, in the same track.
+// Field names are case insensitive, so artist=X and ARTIST=X are duplicates.
+func findDuplicateTags(flacs []*flac.Flac) []string {
+	var problems []string
+	seen := make(map[rawTag]bool)
+	for _, t := range getRawTags(flacs) {
+		key := rawTag{track: t.track, field: strings.ToUpper(t.field), value: t.value}
+		if seen[key] {
+			problems = append(problems, t.String())
+		}
+		seen[key] = true
+	}
+	return problems
+}
+
+// findNonCanonicalFieldNames returns lowercase or unconventional tag field names.
+func findNonCanonicalFieldNames(flacs []*flac.Flac) []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for _, t := range getRawTags(flacs) {
+		id := t.track + t.field
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		upper := strings.ToUpper(t.field)
+		switch {
+		case nonCanonicalFieldNames[upper] != "":
+			problems = append(problems, fmt.Sprintf("%s: %s should be %s", t.track, t.field, nonCanonicalFieldNames[upper]))
+		case t.field != upper:
+			problems = append(problems, fmt.Sprintf("%s: %s should be %s", t.track, t.field, upper))
+		}
+	}
+	return problems
+}
+
+// findTagsWithControlCharacters returns the tags containing control characters.
+// Line breaks and tabs are accepted in fields where they are to be expected.
+func findTagsWithControlCharacters(flacs []*flac.Flac) []string {
+	return filterRawTags(getRawTags(flacs), func(t rawTag) bool {
+		multiLine := strslice.ContainsCaseInsensitive(multiLineFields, t.field)
+		for _, r := range t.value {
+			if !unicode.IsControl(r) {
+				continue
+			}
+			if multiLine && (r == '\n' || r == '\r' || r == '\t') {
+				continue
+			}
+			return true
+		}
+		return false
+	})
+}
+
+// findMojibakeTags returns the tags which seem to have been encoded twice in UTF-8.
+func findMojibakeTags(flacs []*flac.Flac) []string {
+	return filterRawTags(getRawTags(flacs), func(t rawTag) bool {
+		return isMojibake(t.value)
+	})
+}
+
+// isMojibake detects UTF-8 strings that were wrongly decoded as Windows-1252 and re-encoded as UTF-8.
+// Going back to Windows-1252 gives valid UTF-8 with multibyte characters only in that case.
+func isMojibake(s string) bool {
+	if isASCII(s) {
+		return false
+	}
+	original, err := charmap.Windows1252.NewEncoder().String(s)
+	if err != nil {
+		// characters outside of Windows-1252, cannot be a double encoding
+		return false
+	}
+	return !isASCII(original) && utf8.ValidString(original)
+}
+
+// findTaggerCruft returns fields left by rippers or taggers, and URLs in comments.
+func findTaggerCruft(flacs []*flac.Flac) []string {
+	re := regexp.MustCompile(regexpURL)
+	return filterRawTags(getRawTags(flacs), func(t rawTag) bool {
+		if strslice.ContainsCaseInsensitive(taggerCruftFields, t.field) {
+			return true
+		}
+		return strslice.ContainsCaseInsensitive(taggerCruftURLFields, t.field) && re.MatchString(t.value)
+	})
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
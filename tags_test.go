@@ -0,0 +1,115 @@
+package propolis
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/flac"
+)
+
+func TestIsMojibake(t *testing.T) {
+	fmt.Println("+ Testing isMojibake...")
+	check := assert.New(t)
+
+	cases := map[string]bool{
+		"":                   false,
+		"Plain ASCII":        false,
+		"Café":               false,
+		"Björk":              false,
+		"Sigur Rós – Ágætis": false,
+		// outside of Windows-1252
+		"日本語": false,
+		// not valid UTF-8 once converted back to Windows-1252
+		"Ã":         false,
+		"À bientôt": false,
+		// encoded twice
+		"CafÃ©":        true,
+		"BjÃ¶rk":       true,
+		"Donâ€™t Stop": true,
+		"Ã€ bientÃ´t":  true,
+	}
+	for value, expected := range cases {
+		check.Equal(expected, isMojibake(value), value)
+	}
+}
+
+func TestRawTagFinders(t *testing.T) {
+	fmt.Println("+ Testing tag hygiene finders...")
+	check := assert.New(t)
+
+	cases := []struct {
+		name     string
+		find     func([]*flac.Flac) []string
+		tags     []string
+		expected []string
+	}{
+		{
+			name:     "whitespace",
+			find:     findTagsWithExtraWhitespace,
+			tags:     []string{"TITLE= Title", "ALBUM=Album", "ARTIST=Artist\t", "COMMENT=  ", "DATE="},
+			expected: []string{`01.flac: ARTIST="Artist\t"`, `01.flac: COMMENT="  "`, `01.flac: TITLE=" Title"`},
+		},
+		{
+			name:     "empty",
+			find:     findEmptyTags,
+			tags:     []string{"TITLE=", "DATE= ", "ALBUM=Album"},
+			expected: []string{`01.flac: DATE=" "`, `01.flac: TITLE=""`},
+		},
+		{
+			name:     "duplicates",
+			find:     findDuplicateTags,
+			tags:     []string{"ARTIST=A", "artist=A", "ARTIST=B", "GENRE=Rock", "GENRE=Rock"},
+			expected: []string{`01.flac: GENRE="Rock"`, `01.flac: artist="A"`},
+		},
+		{
+			name:     "non-canonical field names",
+			find:     findNonCanonicalFieldNames,
+			tags:     []string{"ALBUM ARTIST=X", "title=T", "TRACKNUMBER=1", "Publisher=L", "title=U"},
+			expected: []string{"01.flac: ALBUM ARTIST should be ALBUMARTIST", "01.flac: Publisher should be LABEL", "01.flac: title should be TITLE"},
+		},
+		{
+			name:     "control characters",
+			find:     findTagsWithControlCharacters,
+			tags:     []string{"TITLE=Ti\x00tle", "COMMENT=line\nline", "ALBUM=Al\tbum", "LYRICS=a\r\nb", "ARTIST=Artist"},
+			expected: []string{`01.flac: ALBUM="Al\tbum"`, `01.flac: TITLE="Ti\x00tle"`},
+		},
+		{
+			name:     "mojibake",
+			find:     findMojibakeTags,
+			tags:     []string{"TITLE=CafÃ©", "ALBUM=Café"},
+			expected: []string{`01.flac: TITLE="CafÃ©"`},
+		},
+		{
+			name:     "tagger cruft",
+			find:     findTaggerCruft,
+			tags:     []string{"ENCODEDBY=dBpoweramp", "COMMENT=Visit www.example.com", "DESCRIPTION=no link", "CONTACT=http://label.example", "Ripper=EAC", "TITLE=www.example.com"},
+			expected: []string{`01.flac: COMMENT="Visit www.example.com"`, `01.flac: CONTACT="http://label.example"`, `01.flac: ENCODEDBY="dBpoweramp"`, `01.flac: Ripper="EAC"`},
+		},
+		{
+			name: "clean",
+			find: func(flacs []*flac.Flac) []string {
+				var all []string
+				for _, find := range []func([]*flac.Flac) []string{findTagsWithExtraWhitespace, findEmptyTags, findDuplicateTags, findNonCanonicalFieldNames, findTagsWithControlCharacters, findMojibakeTags, findTaggerCruft} {
+					all = append(all, find(flacs)...)
+				}
+				return all
+			},
+			tags: []string{"TITLE=Title", "ARTIST=Björk", "ALBUMARTIST=Björk", "TRACKNUMBER=1", "COMMENT=Recorded live\nin 1999"},
+		},
+	}
+	for _, c := range cases {
+		f := writeTestFlac(t, filepath.Join(t.TempDir(), "01.flac"), 2, testBlockSize, noise, c.tags...)
+		check.Equal(c.expected, c.find([]*flac.Flac{f}), c.name)
+	}
+
+	// problems are reported track by track
+	dir := t.TempDir()
+	flacs := []*flac.Flac{
+		writeTestFlac(t, filepath.Join(dir, "01.flac"), 2, testBlockSize, noise, "TITLE=One "),
+		writeTestFlac(t, filepath.Join(dir, "02.flac"), 2, testBlockSize, noise, "TITLE=Two"),
+		writeTestFlac(t, filepath.Join(dir, "03.flac"), 2, testBlockSize, noise, "TITLE=Three "),
+	}
+	check.Equal([]string{`01.flac: TITLE="One "`, `03.flac: TITLE="Three "`}, findTagsWithExtraWhitespace(flacs))
+}
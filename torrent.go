@@ -0,0 +1,397 @@
+package propolis
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/ui"
+)
+
+var (
+	// files left by operating systems, never included in torrents.
+	osCruftFiles = []string{".ds_store", "thumbs.db", "desktop.ini", ".directory"}
+
+	// piece sizes, by maximum release size.
+	torrentPieceSizes = []struct {
+		maxSize   int64
+		pieceSize int64
+	}{
+		{50 * Size1024KiB, 32 * 1024},
+		{150 * Size1024KiB, 64 * 1024},
+		{350 * Size1024KiB, 128 * 1024},
+		{512 * Size1024KiB, 256 * 1024},
+		{1024 * Size1024KiB, 512 * 1024},
+		{2048 * Size1024KiB, Size1024KiB},
+		{4096 * Size1024KiB, 2 * Size1024KiB},
+		{8192 * Size1024KiB, 4 * Size1024KiB},
+		{16384 * Size1024KiB, 8 * Size1024KiB},
+	}
+)
+
+const maxTorrentPieceSize = 16 * Size1024KiB
+
+func isOSCruft(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for _, c := range osCruftFiles {
+		if name == c {
+			return true
+		}
+	}
+	// AppleDouble files
+	return strings.HasPrefix(name, "._")
+}
+
+func torrentPieceSize(totalSize int64) int64 {
+	for _, s := range torrentPieceSizes {
+		if totalSize <= s.maxSize {
+			return s.pieceSize
+		}
+	}
+	return maxTorrentPieceSize
+}
+
+// torrentFiles of a release, without its metadata folder and OS cruft.
+func torrentFiles(root, metadataDir string, snatched bool) ([]string, error) {
+	files, err := getReleaseFiles(root, snatched)
+	if err != nil {
+		return nil, err
+	}
+	// the metadata folder is only inside the release in snatched mode, but a metadata root could also be there.
+	metadataRel, err := filepath.Rel(root, metadataDir)
+	if err != nil || strings.HasPrefix(metadataRel, "..") {
+		metadataRel = ""
+	}
+	var clean []string
+	for _, f := range files {
+		if isOSCruft(f) || (metadataRel != "" && strings.HasPrefix(f, metadataRel+string(filepath.Separator))) {
+			continue
+		}
+		clean = append(clean, f)
+	}
+	return clean, nil
+}
+
+// torrentInfo dictionary for files of a release, in order. Its hash is the torrent info-hash.
+func torrentInfo(root string, files []string, source string) (map[string]interface{}, error) {
+	var totalSize int64
+	var fileList []interface{}
+	for _, f := range files {
+		info, err := os.Stat(filepath.Join(root, f))
+		if err != nil {
+			return nil, err
+		}
+		totalSize += info.Size()
+		fileList = append(fileList, map[string]interface{}{"length": info.Size(), "path": strings.Split(filepath.ToSlash(f), "/")})
+	}
+	if totalSize == 0 {
+		return nil, errors.New("nothing to put in the torrent")
+	}
+
+	// hashing all files as one stream, cut in pieces
+	pieceSize := torrentPieceSize(totalSize)
+	var pieces bytes.Buffer
+	piece := make([]byte, pieceSize)
+	var filled int64
+	for _, f := range files {
+		file, err := os.Open(filepath.Join(root, f))
+		if err != nil {
+			return nil, err
+		}
+		for {
+			n, err := io.ReadFull(file, piece[filled:])
+			filled += int64(n)
+			if filled == pieceSize {
+				hash := sha1.Sum(piece)
+				pieces.Write(hash[:])
+				filled = 0
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		file.Close()
+	}
+	if filled != 0 {
+		hash := sha1.Sum(piece[:filled])
+		pieces.Write(hash[:])
+	}
+
+	info := map[string]interface{}{
+		"name":         filepath.Base(root),
+		"piece length": pieceSize,
+		"pieces":       pieces.Bytes(),
+		"private":      1,
+		"files":        fileList,
+	}
+	if source != "" {
+		info["source"] = source
+	}
+	return info, nil
+}
+
+// infoHash of a torrent info dictionary.
+func infoHash(info map[string]interface{}) (string, error) {
+	var buffer bytes.Buffer
+	if err := bencode(&buffer, info); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha1.Sum(buffer.Bytes())), nil
+}
+
+// SaveTorrent of a release in its metadata folder, for a private tracker. It returns the .torrent path and its
+// info-hash.
+func SaveTorrent(root, metadataDir, announce, source string, snatched bool, version string) (string, string, error) {
+	files, err := torrentFiles(root, metadataDir, snatched)
+	if err != nil {
+		return "", "", err
+	}
+	info, err := torrentInfo(root, files, source)
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := infoHash(info)
+	if err != nil {
+		return "", "", err
+	}
+	torrent := map[string]interface{}{
+		"announce":      announce,
+		"created by":    "propolis " + version,
+		"creation date": time.Now().Unix(),
+		"info":          info,
+	}
+	var buffer bytes.Buffer
+	if err := bencode(&buffer, torrent); err != nil {
+		return "", "", err
+	}
+	if !fs.DirExists(metadataDir) {
+		if err := os.MkdirAll(metadataDir, 0777); err != nil {
+			return "", "", err
+		}
+	}
+	torrentFile := filepath.Join(metadataDir, filepath.Base(root)+".torrent")
+	return torrentFile, hash, ioutil.WriteFile(torrentFile, buffer.Bytes(), 0600)
+}
+
+// MakeTorrent for a release after checking it, unless it has problems and force is false.
+func MakeTorrent(path string, options Options, announce, source string, force bool, version string) error {
+	logthis.Info(ui.YellowBold(ArrowHeader+"Checking "+path+" before creating the torrent"), logthis.NORMAL)
+	metadataDir := MetadataDir(path, options.MetadataRoot, options.Snatched)
+	analysis, _ := analyseChangedGroups(path, metadataDir, options, version, nil, nil)
+	logthis.Info(ui.Blue(analysis.Summary()), logthis.NORMAL)
+	if analysis.Errors != 0 {
+		for _, c := range analysis.Checks {
+			if c.Result == KO {
+				logthis.Info(c.String(), logthis.NORMAL)
+			}
+		}
+		if !force {
+			return errors.New(KOTorrentProblems)
+		}
+		logthis.Info(ui.Yellow(ForcedTorrent), logthis.NORMAL)
+	}
+	torrentFile, hash, err := SaveTorrent(path, metadataDir, announce, source, options.Snatched, version)
+	if err != nil {
+		return errors.Wrap(err, "could not create torrent")
+	}
+	logthis.Info(ui.BlueBold(fmt.Sprintf("Torrent saved in %s, info-hash %s.", torrentFile, hash)), logthis.NORMAL)
+	return nil
+}
+
+type torrentFile struct {
+	path   string
+	length int64
+}
+
+// torrentMetadata is what is needed from a .torrent to verify a release.
+type torrentMetadata struct {
+	name        string
+	infoHash    string
+	pieceLength int64
+	pieces      string
+	files       []torrentFile
+}
+
+// readTorrent file, single or multiple files.
+func readTorrent(path string) (*torrentMetadata, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &bdecoder{data: data}
+	value, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	root, ok := value.(map[string]interface{})
+	if !ok || d.infoEnd == 0 {
+		return nil, errors.New("no info dictionary found")
+	}
+	info, ok := root["info"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid info dictionary")
+	}
+	t := &torrentMetadata{infoHash: fmt.Sprintf("%x", sha1.Sum(data[d.infoStart:d.infoEnd]))}
+	t.name, _ = info["name"].(string)
+	t.pieceLength, _ = info["piece length"].(int64)
+	t.pieces, _ = info["pieces"].(string)
+	if t.pieceLength <= 0 || len(t.pieces)%sha1.Size != 0 {
+		return nil, errors.New("invalid pieces")
+	}
+	if files, ok := info["files"].([]interface{}); ok {
+		for _, f := range files {
+			file, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("invalid file list")
+			}
+			length, _ := file["length"].(int64)
+			pathParts, _ := file["path"].([]interface{})
+			var parts []string
+			for _, p := range pathParts {
+				part, ok := p.(string)
+				if !ok || !isTorrentPathPart(part) {
+					return nil, errors.New("invalid file list")
+				}
+				parts = append(parts, part)
+			}
+			if len(parts) == 0 {
+				return nil, errors.New("invalid file list")
+			}
+			t.files = append(t.files, torrentFile{path: filepath.Join(parts...), length: length})
+		}
+	} else {
+		// single file torrent
+		if !isTorrentPathPart(t.name) {
+			return nil, errors.New("invalid file list")
+		}
+		length, _ := info["length"].(int64)
+		t.files = append(t.files, torrentFile{path: t.name, length: length})
+	}
+	return t, nil
+}
+
+// isTorrentPathPart returns true if a file or folder name from a .torrent cannot point outside of the release.
+func isTorrentPathPart(part string) bool {
+	return part != "" && part != "." && part != ".." && !filepath.IsAbs(part) && !strings.ContainsAny(part, `/\`)
+}
+
+// findTrackerTorrent saved by varroa with the release, in snatched mode.
+func findTrackerTorrent(root string) string {
+	files := fs.GetAllowedFilesByExt(filepath.Join(root, "TrackerMetadata"), []string{".torrent"})
+	if len(files) == 0 {
+		return ""
+	}
+	return files[0]
+}
+
+// paddedFileReader reads exactly length bytes of a file, completed with zeros if it is missing or too short, so that
+// pieces can still be checked in order.
+func paddedFileReader(path string, length int64) (io.Reader, func()) {
+	padding := io.LimitReader(zeroReader{}, length)
+	file, err := os.Open(path)
+	if err != nil {
+		return padding, func() {}
+	}
+	return io.LimitReader(io.MultiReader(file, padding), length), func() { file.Close() }
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+// compareWithTorrent returns the files listed in the torrent that are missing, the files that are not in the torrent,
+// and the corrupted files, with evidence.
+func compareWithTorrent(root, metadataDir string, snatched bool, t *torrentMetadata) ([]string, []string, []string, error) {
+	local, err := torrentFiles(root, metadataDir, snatched)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var missing, extra, corrupted []string
+	listed := make(map[string]bool)
+	// files already known to be missing or corrupted, no need to show their bad pieces
+	known := make(map[string]bool)
+	var readers []io.Reader
+	var closers []func()
+	defer func() {
+		for _, c := range closers {
+			c()
+		}
+	}()
+	for _, f := range t.files {
+		listed[f.path] = true
+		path := filepath.Join(root, f.path)
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			missing = append(missing, f.path)
+			known[f.path] = true
+		case info.Size() != f.length:
+			known[f.path] = true
+			corrupted = append(corrupted, fmt.Sprintf("%s: size is %d bytes, the torrent expects %d bytes", f.path, info.Size(), f.length))
+		}
+		r, closer := paddedFileReader(path, f.length)
+		readers = append(readers, r)
+		closers = append(closers, closer)
+	}
+	for _, f := range local {
+		if !listed[f] {
+			extra = append(extra, f)
+		}
+	}
+
+	// hashing pieces, and finding which files the bad pieces belong to
+	badPieces := make(map[string][]int)
+	stream := io.MultiReader(readers...)
+	piece := make([]byte, t.pieceLength)
+	var offset int64
+	for i := 0; i < len(t.pieces)/sha1.Size; i++ {
+		n, err := io.ReadFull(stream, piece)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, nil, nil, errors.Wrap(err, "could not read piece")
+		}
+		hash := sha1.Sum(piece[:n])
+		if string(hash[:]) != t.pieces[i*sha1.Size:(i+1)*sha1.Size] {
+			var fileStart int64
+			var spanned []string
+			explained := false
+			for _, f := range t.files {
+				if fileStart < offset+int64(n) && offset < fileStart+f.length {
+					spanned = append(spanned, f.path)
+					explained = explained || known[f.path]
+				}
+				fileStart += f.length
+			}
+			// a piece shared with a missing or truncated file is bad because of it
+			if !explained {
+				for _, f := range spanned {
+					badPieces[f] = append(badPieces[f], i)
+				}
+			}
+		}
+		offset += int64(n)
+	}
+	for _, f := range t.files {
+		if pieces, ok := badPieces[f.path]; ok && !known[f.path] {
+			corrupted = append(corrupted, fmt.Sprintf("%s: %d piece(s) do not match, first one is piece #%d", f.path, len(pieces), pieces[0]))
+		}
+	}
+	return missing, extra, corrupted, nil
+}
@@ -0,0 +1,154 @@
+package propolis
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testTorrentRelease = "Artist - Album (2020) [WEB FLAC]"
+	// computed independently, with a reference bencode implementation
+	testTorrentInfoHash = "979dfeccaff41b1e3d01e9ef55881f79457fba8f"
+)
+
+// writeTestTorrentRelease with two discs, a cover and OS cruft, spanning three torrent pieces.
+func writeTestTorrentRelease(t *testing.T, root string) {
+	one, two := make([]byte, 40000), make([]byte, 30000)
+	for i := range one {
+		one[i] = byte(i % 251)
+	}
+	for i := range two {
+		two[i] = byte(i * 7 % 256)
+	}
+	files := map[string][]byte{
+		"01 - One.flac":     one,
+		"CD2/01 - Two.flac": two,
+		"cover.jpg":         []byte("not really a jpeg"),
+		".DS_Store":         []byte("cruft"),
+		"CD2/._01 - Two":    []byte("cruft"),
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTorrentInfo(t *testing.T) {
+	fmt.Println("+ Testing torrentInfo...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, testTorrentRelease)
+	metadataDir := filepath.Join(dir, "metadata")
+	writeTestTorrentRelease(t, root)
+
+	files, err := torrentFiles(root, metadataDir, false)
+	check.Nil(err)
+	check.Equal([]string{"01 - One.flac", filepath.Join("CD2", "01 - Two.flac"), "cover.jpg"}, files)
+
+	info, err := torrentInfo(root, files, "RED")
+	check.Nil(err)
+	check.Equal(int64(32*1024), info["piece length"])
+	hash, err := infoHash(info)
+	check.Nil(err)
+	check.Equal(testTorrentInfoHash, hash)
+
+	_, hash, err = SaveTorrent(root, metadataDir, "https://tracker/announce", "RED", false, "test")
+	check.Nil(err)
+	check.Equal(testTorrentInfoHash, hash)
+}
+
+func TestCompareWithTorrent(t *testing.T) {
+	fmt.Println("+ Testing compareWithTorrent...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, testTorrentRelease)
+	metadataDir := filepath.Join(dir, "metadata")
+	writeTestTorrentRelease(t, root)
+
+	// saving and reading the .torrent again
+	torrentFile, hash, err := SaveTorrent(root, metadataDir, "https://tracker/announce", "RED", false, "test")
+	check.Nil(err)
+	check.Equal(filepath.Join(metadataDir, testTorrentRelease+".torrent"), torrentFile)
+	metadata, err := readTorrent(torrentFile)
+	check.Nil(err)
+	check.Equal(hash, metadata.infoHash)
+	check.Equal(testTorrentRelease, metadata.name)
+	check.Equal(3, len(metadata.files))
+	check.Equal(3*20, len(metadata.pieces))
+
+	missing, extra, corrupted, err := compareWithTorrent(root, metadataDir, false, metadata)
+	check.Nil(err)
+	check.Empty(missing)
+	check.Empty(extra)
+	check.Empty(corrupted)
+
+	// breaking the release
+	check.Nil(os.Remove(filepath.Join(root, "cover.jpg")))
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "notes.txt"), []byte("extra"), 0600))
+	data, err := ioutil.ReadFile(filepath.Join(root, "01 - One.flac"))
+	check.Nil(err)
+	data[1000]++
+	check.Nil(ioutil.WriteFile(filepath.Join(root, "01 - One.flac"), data, 0600))
+	missing, extra, corrupted, err = compareWithTorrent(root, metadataDir, false, metadata)
+	check.Nil(err)
+	check.Equal([]string{"cover.jpg"}, missing)
+	check.Equal([]string{"notes.txt"}, extra)
+	check.Equal([]string{"01 - One.flac: 1 piece(s) do not match, first one is piece #0"}, corrupted)
+}
+
+func TestReadTorrentPaths(t *testing.T) {
+	fmt.Println("+ Testing readTorrent paths...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	write := func(info map[string]interface{}) string {
+		info["piece length"] = int64(32 * 1024)
+		info["pieces"] = string(make([]byte, 20))
+		var buffer bytes.Buffer
+		check.Nil(bencode(&buffer, map[string]interface{}{"info": info}))
+		path := filepath.Join(dir, "test.torrent")
+		check.Nil(ioutil.WriteFile(path, buffer.Bytes(), 0600))
+		return path
+	}
+	files := func(parts ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"name": "release", "files": []interface{}{map[string]interface{}{"length": int64(1), "path": parts}}}
+	}
+
+	metadata, err := readTorrent(write(files("CD1", "01.flac")))
+	check.Nil(err)
+	check.Equal([]torrentFile{{path: filepath.Join("CD1", "01.flac"), length: 1}}, metadata.files)
+	metadata, err = readTorrent(write(map[string]interface{}{"name": "01.flac", "length": int64(1)}))
+	check.Nil(err)
+	check.Equal([]torrentFile{{path: "01.flac", length: 1}}, metadata.files)
+
+	// paths escaping the release folder are rejected
+	for _, info := range []map[string]interface{}{
+		files("..", "01.flac"),
+		files("CD1", "..", "..", "01.flac"),
+		files("."),
+		files("/etc", "passwd"),
+		files("CD1/../../01.flac"),
+		files(`CD1\..\01.flac`),
+		files(""),
+		files(),
+		files(int64(1)),
+		{"name": "..", "length": int64(1)},
+		{"name": "../01.flac", "length": int64(1)},
+	} {
+		_, err = readTorrent(write(info))
+		check.EqualError(err, "invalid file list", fmt.Sprintf("%v", info))
+	}
+}
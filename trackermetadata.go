@@ -0,0 +1,113 @@
+package propolis
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/fs"
+)
+
+const (
+	varroaMetadataDir = "TrackerMetadata"
+	// log scores are only approximated, smaller differences with the tracker logchecker are expected.
+	logScoreTolerance = 10
+
+	// formats and lossless encodings, as in Gazelle upload forms.
+	formatFLAC            = "FLAC"
+	formatMP3             = "MP3"
+	encodingLossless      = "Lossless"
+	encoding24bitLossless = "24bit Lossless"
+)
+
+type trackerArtist struct {
+	Name string `json:"name"`
+}
+
+// trackerRelease is the part of a Gazelle torrent API response, as saved by varroa, that can be checked.
+type trackerRelease struct {
+	Group struct {
+		Name      string `json:"name"`
+		Year      int    `json:"year"`
+		MusicInfo struct {
+			Artists []trackerArtist `json:"artists"`
+		} `json:"musicInfo"`
+	} `json:"group"`
+	Torrent struct {
+		Media        string `json:"media"`
+		Format       string `json:"format"`
+		Encoding     string `json:"encoding"`
+		RemasterYear int    `json:"remasterYear"`
+		HasLog       bool   `json:"hasLog"`
+		LogScore     int    `json:"logScore"`
+		HasCue       bool   `json:"hasCue"`
+	} `json:"torrent"`
+}
+
+// artists of the release on the tracker, unescaped.
+func (t *trackerRelease) artists() []string {
+	var artists []string
+	for _, a := range t.Group.MusicInfo.Artists {
+		artists = append(artists, html.UnescapeString(a.Name))
+	}
+	return artists
+}
+
+// title of the release on the tracker, unescaped.
+func (t *trackerRelease) title() string {
+	return html.UnescapeString(t.Group.Name)
+}
+
+// readTrackerMetadata finds the tracker release JSON saved by varroa in snatched releases.
+// Responses can be saved as is, or without their "response" wrapper.
+func readTrackerMetadata(root string) (*trackerRelease, string, error) {
+	files := fs.GetAllowedFilesByExt(filepath.Join(root, varroaMetadataDir), []string{".json"})
+	if len(files) == 0 {
+		return nil, "", errors.New("no JSON file found in " + varroaMetadataDir)
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, "", err
+		}
+		var wrapped struct {
+			Response *trackerRelease `json:"response"`
+		}
+		var release trackerRelease
+		if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.Response != nil {
+			release = *wrapped.Response
+		} else if err := json.Unmarshal(data, &release); err != nil {
+			continue
+		}
+		if release.Group.Name != "" && release.Torrent.Format != "" {
+			return &release, f, nil
+		}
+	}
+	return nil, "", errors.New("no tracker release metadata found in " + varroaMetadataDir)
+}
+
+// sameTitle if two titles are equal, ignoring case and surrounding spaces.
+func sameTitle(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// trackerLogScoreProblems for rip logs that cannot be read, or that score very differently from what the tracker says.
+func trackerLogScoreProblems(rips []string, trackerScore int) []string {
+	var problems []string
+	for _, r := range rips {
+		if strings.ToLower(filepath.Ext(r)) != ".log" {
+			continue
+		}
+		l, err := readRipLog(r)
+		if err != nil {
+			problems = append(problems, filepath.Base(r)+": "+err.Error())
+		} else if l.ripper != ripperUnknown && (l.score > trackerScore+logScoreTolerance || l.score < trackerScore-logScoreTolerance) {
+			problems = append(problems, fmt.Sprintf("%s: %d (%s)", l.path, l.score, strings.Join(l.deductions, ", ")))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,90 @@
+package propolis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testTrackerRelease = `{
+	"group": {"name": "Album &amp; More", "year": 2020, "musicInfo": {"artists": [{"name": "Artist"}, {"name": "Other &amp; Co"}]}},
+	"torrent": {"media": "CD", "format": "FLAC", "encoding": "Lossless", "remasterYear": 2021, "hasLog": true, "logScore": 100, "hasCue": true}
+}`
+
+func TestReadTrackerMetadata(t *testing.T) {
+	fmt.Println("+ Testing readTrackerMetadata...")
+	check := assert.New(t)
+
+	root := t.TempDir()
+	_, _, err := readTrackerMetadata(root)
+	check.NotNil(err)
+
+	metadataDir := filepath.Join(root, varroaMetadataDir)
+	check.Nil(os.MkdirAll(metadataDir, 0777))
+	check.Nil(ioutil.WriteFile(filepath.Join(metadataDir, "a.json"), []byte("not json"), 0600))
+	check.Nil(ioutil.WriteFile(filepath.Join(metadataDir, "b.json"), []byte(`{"status": "success", "response": {"id": 1}}`), 0600))
+	check.Nil(ioutil.WriteFile(filepath.Join(metadataDir, "c.txt"), []byte(testTrackerRelease), 0600))
+	_, _, err = readTrackerMetadata(root)
+	check.NotNil(err)
+
+	for _, contents := range []string{
+		`{"status": "success", "response": ` + testTrackerRelease + `}`,
+		testTrackerRelease,
+	} {
+		check.Nil(ioutil.WriteFile(filepath.Join(metadataDir, "d.json"), []byte(contents), 0600))
+		release, file, err := readTrackerMetadata(root)
+		check.Nil(err)
+		check.Equal(filepath.Join(metadataDir, "d.json"), file)
+		check.Equal("Album & More", release.title())
+		check.Equal([]string{"Artist", "Other & Co"}, release.artists())
+		check.Equal(2020, release.Group.Year)
+		check.Equal("CD", release.Torrent.Media)
+		check.Equal("FLAC", release.Torrent.Format)
+		check.Equal(encodingLossless, release.Torrent.Encoding)
+		check.Equal(2021, release.Torrent.RemasterYear)
+		check.True(release.Torrent.HasLog)
+		check.Equal(100, release.Torrent.LogScore)
+		check.True(release.Torrent.HasCue)
+	}
+}
+
+func TestTrackerLogScoreProblems(t *testing.T) {
+	fmt.Println("+ Testing trackerLogScoreProblems...")
+	check := assert.New(t)
+
+	dir := t.TempDir()
+	logs := map[string]string{
+		// 100
+		"perfect.log": "Exact Audio Copy\nRead mode : Secure\nDefeat audio cache : Yes\nTest CRC\n==== Log checksum",
+		// 90, test and copy not used
+		"no test.log": "Exact Audio Copy\nRead mode : Secure\nDefeat audio cache : Yes\n==== Log checksum",
+		// 60, not ripped in secure mode
+		"burst.log": "Exact Audio Copy\nRead mode : Burst\nDefeat audio cache : Yes\nTest CRC\n==== Log checksum",
+		"other.log": "not a rip log",
+	}
+	for name, content := range logs {
+		check.Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	rips := func(names ...string) []string {
+		var paths []string
+		for _, n := range names {
+			paths = append(paths, filepath.Join(dir, n))
+		}
+		return paths
+	}
+
+	// small differences are expected from an approximation
+	check.Empty(trackerLogScoreProblems(rips("perfect.log", "no test.log", "other.log", "album.cue"), 100))
+	check.Empty(trackerLogScoreProblems(rips("perfect.log", "no test.log"), 95))
+	check.Empty(trackerLogScoreProblems(rips("no test.log"), 80))
+	check.Equal([]string{"burst.log: 60 (not ripped in secure mode)"}, trackerLogScoreProblems(rips("perfect.log", "burst.log"), 100))
+	check.Equal([]string{"perfect.log: 100 ()", "no test.log: 90 (test and copy not used)"}, trackerLogScoreProblems(rips("perfect.log", "no test.log", "burst.log"), 60))
+	problems := trackerLogScoreProblems(rips("missing.log"), 100)
+	if check.Equal(1, len(problems)) {
+		check.Contains(problems[0], "missing.log: ")
+	}
+}
@@ -0,0 +1,188 @@
+package propolis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/strslice"
+)
+
+// artist roles, as in Gazelle upload forms.
+const (
+	roleMain      = "main"
+	roleGuest     = "guest"
+	roleRemixer   = "remixer"
+	roleComposer  = "composer"
+	roleConductor = "conductor"
+)
+
+// release types, as in Gazelle upload forms.
+const (
+	releaseTypeAlbum       = "Album"
+	releaseTypeEP          = "EP"
+	releaseTypeSingle      = "Single"
+	releaseTypeCompilation = "Compilation"
+)
+
+var (
+	catalogueNumberFields = []string{"CATALOGNUMBER", "CATALOGUENUMBER", "LABELNO"}
+	genreSeparators       = regexp.MustCompile(`\s*[;,/]\s*`)
+	tagForbiddenRunes     = regexp.MustCompile(`[^a-z0-9.]+`)
+)
+
+type uploadArtist struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// uploadForm holds the fields of a Gazelle upload form, as found in the release.
+type uploadForm struct {
+	Artists         []uploadArtist `json:"artists"`
+	Title           string         `json:"title"`
+	Year            int            `json:"year"`
+	RecordLabel     string         `json:"record_label"`
+	CatalogueNumber string         `json:"catalogue_number"`
+	ReleaseType     string         `json:"release_type"`
+	Media           string         `json:"media"`
+	Format          string         `json:"format"`
+	Bitrate         string         `json:"bitrate"`
+	Tags            []string       `json:"tags"`
+	Description     string         `json:"release_description"`
+}
+
+// rawTagValue of the first field found in a track, case insensitive.
+func rawTagValue(f *flac.Flac, fields ...string) string {
+	for k, v := range f.RawTags() {
+		if strslice.Contains(fields, strings.ToUpper(k)) && len(v) != 0 {
+			return strings.TrimSpace(v[0])
+		}
+	}
+	return ""
+}
+
+// guessReleaseType from the number of tracks and the total duration, using the usual digital store limits.
+func guessReleaseType(tracks int, totalSeconds float64, variousArtists bool) string {
+	switch {
+	case variousArtists:
+		return releaseTypeCompilation
+	case tracks <= 3 && totalSeconds < 30*60:
+		return releaseTypeSingle
+	case tracks <= 6 && totalSeconds < 30*60:
+		return releaseTypeEP
+	default:
+		return releaseTypeAlbum
+	}
+}
+
+// trackerTags from genre tags: lower case, with dots instead of spaces.
+func trackerTags(genres []string) []string {
+	var tags []string
+	for _, g := range genres {
+		for _, t := range genreSeparators.Split(g, -1) {
+			t = strings.Trim(tagForbiddenRunes.ReplaceAllString(strings.ToLower(t), "."), ".")
+			if t != "" && !strslice.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
+// uploadForm of the release, with a BBCode description.
+func (p *Propolis) uploadForm(descriptionTemplate, overviewFile string) (*uploadForm, error) {
+	d := p.describe(overviewFile)
+	form := &uploadForm{Title: d.Album, Media: d.Source, Format: d.Format, Bitrate: d.Encoding, Tags: []string{}, Artists: []uploadArtist{}}
+	form.Year, _ = strconv.Atoi(d.Year)
+	// the media must be chosen by the uploader if the source is unknown
+	if form.Media == sourceUnknown {
+		form.Media = ""
+	}
+	var err error
+	if form.Description, err = p.renderDescription(DescriptionBBCode, descriptionTemplate, overviewFile); err != nil {
+		return nil, err
+	}
+	addArtists := func(names []string, role string) {
+		for _, n := range names {
+			a := uploadArtist{Name: n, Role: role}
+			found := false
+			for _, e := range form.Artists {
+				if strings.EqualFold(e.Name, a.Name) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				form.Artists = append(form.Artists, a)
+			}
+		}
+	}
+	if len(p.release.Flacs) == 0 {
+		// MP3 releases, ID3 tags only have main artists
+		var totalSeconds float64
+		for _, t := range p.mp3s {
+			totalSeconds += t.DurationSeconds
+			if d.VariousArtists {
+				addArtists([]string{t.Artist}, roleGuest)
+			} else if t.AlbumArtist != "" {
+				addArtists([]string{t.AlbumArtist}, roleMain)
+			} else {
+				addArtists([]string{t.Artist}, roleMain)
+			}
+		}
+		if len(p.mp3s) != 0 {
+			form.ReleaseType = guessReleaseType(len(p.mp3s), totalSeconds, d.VariousArtists)
+		}
+		return form, nil
+	}
+
+	first := p.release.Flacs[0]
+	tags := first.CommonTags()
+	form.RecordLabel = tags.Label
+	form.CatalogueNumber = rawTagValue(first, catalogueNumberFields...)
+	var totalSeconds float64
+	var genres []string
+	if !d.VariousArtists {
+		addArtists(tags.AlbumArtist, roleMain)
+	}
+	for _, f := range p.release.Flacs {
+		t := f.CommonTags()
+		totalSeconds += float64(f.DurationSeconds)
+		genres = append(genres, t.Genre)
+		if !d.VariousArtists {
+			addArtists(t.Artist, roleMain)
+		}
+		addArtists(t.Guest, roleGuest)
+		addArtists(t.Remixer, roleRemixer)
+		addArtists(t.Composer, roleComposer)
+		addArtists(t.Conductor, roleConductor)
+	}
+	if d.VariousArtists {
+		// compilations only list the track artists as guests
+		for _, f := range p.release.Flacs {
+			addArtists(f.CommonTags().Artist, roleGuest)
+		}
+	}
+	// keeping an empty list if no genre is tagged
+	if tags := trackerTags(genres); len(tags) != 0 {
+		form.Tags = tags
+	}
+	form.ReleaseType = guessReleaseType(len(p.release.Flacs), totalSeconds, d.VariousArtists)
+	return form, nil
+}
+
+// SaveUploadForm of the release as JSON, for upload scripts.
+func (p *Propolis) SaveUploadForm(path, descriptionTemplate, overviewFile string) error {
+	form, err := p.uploadForm(descriptionTemplate, overviewFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(form, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,95 @@
+package propolis
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/music"
+)
+
+func TestTrackerTags(t *testing.T) {
+	fmt.Println("+ Testing trackerTags...")
+	check := assert.New(t)
+
+	cases := []struct {
+		genres   []string
+		expected []string
+	}{
+		{nil, nil},
+		{[]string{""}, nil},
+		{[]string{"Rock"}, []string{"rock"}},
+		{[]string{"Hip Hop"}, []string{"hip.hop"}},
+		{[]string{"Rock; Pop", "rock,Jazz / Funk"}, []string{"rock", "pop", "jazz", "funk"}},
+		{[]string{"Drum & Bass", "Rock 'n' Roll"}, []string{"drum.bass", "rock.n.roll"}},
+		{[]string{"  Electronic  ", "-Ambient-"}, []string{"electronic", "ambient"}},
+		{[]string{"Post-Rock", "20th Century"}, []string{"post.rock", "20th.century"}},
+		{[]string{"!!!", " ; "}, nil},
+	}
+	for _, c := range cases {
+		check.Equal(c.expected, trackerTags(c.genres), fmt.Sprintf("%q", c.genres))
+	}
+}
+
+func TestGuessReleaseType(t *testing.T) {
+	fmt.Println("+ Testing guessReleaseType...")
+	check := assert.New(t)
+
+	cases := []struct {
+		tracks         int
+		totalSeconds   float64
+		variousArtists bool
+		expected       string
+	}{
+		{1, 4 * 60, false, releaseTypeSingle},
+		{3, 20 * 60, false, releaseTypeSingle},
+		{4, 20 * 60, false, releaseTypeEP},
+		{6, 29 * 60, false, releaseTypeEP},
+		{7, 29 * 60, false, releaseTypeAlbum},
+		{3, 45 * 60, false, releaseTypeAlbum},
+		{12, 50 * 60, false, releaseTypeAlbum},
+		{2, 8 * 60, true, releaseTypeCompilation},
+		{20, 80 * 60, true, releaseTypeCompilation},
+	}
+	for _, c := range cases {
+		check.Equal(c.expected, guessReleaseType(c.tracks, c.totalSeconds, c.variousArtists), fmt.Sprintf("%+v", c))
+	}
+}
+
+func TestUploadForm(t *testing.T) {
+	fmt.Println("+ Testing uploadForm...")
+	check := assert.New(t)
+
+	root := filepath.Join(t.TempDir(), "Artist - Album (2020) [WEB FLAC]")
+	release := music.New(root)
+	for i := 1; i <= 2; i++ {
+		release.Flacs = append(release.Flacs, writeTestFlac(t, filepath.Join(root, fmt.Sprintf("%02d.flac", i)), 2, testSampleRate, noise,
+			"ALBUMARTIST=Artist", "ARTIST=Artist", "ALBUM=Album", "DATE=2020", fmt.Sprintf("TRACKNUMBER=%d", i), fmt.Sprintf("TITLE=Track %d", i)))
+	}
+	p := NewPropolis(root, release, false)
+
+	// without genres, tags are an empty list
+	form, err := p.uploadForm("", "")
+	check.Nil(err)
+	check.Equal([]string{}, form.Tags)
+	check.Equal([]uploadArtist{{Name: "Artist", Role: roleMain}}, form.Artists)
+	check.Equal("Album", form.Title)
+	check.Equal(2020, form.Year)
+	check.Equal(sourceWEB, form.Media)
+	check.Equal(formatFLAC, form.Format)
+	check.Equal(encodingLossless, form.Bitrate)
+	check.Equal(releaseTypeSingle, form.ReleaseType)
+	data, err := json.Marshal(form)
+	check.Nil(err)
+	check.Contains(string(data), `"tags":[]`)
+	check.NotContains(string(data), "null")
+
+	// with genres
+	release.Flacs = []*flac.Flac{writeTestFlac(t, filepath.Join(root, "01.flac"), 2, testSampleRate, noise, "ALBUMARTIST=Artist", "ALBUM=Album", "TITLE=Track 1", "GENRE=Rock; Hip Hop")}
+	form, err = p.uploadForm("", "")
+	check.Nil(err)
+	check.Equal([]string{"rock", "hip.hop"}, form.Tags)
+}
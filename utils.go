@@ -2,7 +2,9 @@ package propolis
 
 import (
 	"os/exec"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -18,6 +20,31 @@ func CheckExternalBinaries(externalBinaries ...string) error {
 	return nil
 }
 
+// runInParallel calls work for every index in [0, n), with at most jobs calls at the same time.
+// If jobs is not strictly positive, the number of CPUs is used.
+// Results are expected to be stored by index, so that their order does not depend on scheduling.
+func runInParallel(jobs, n int, work func(i int)) {
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
 func IgnoreVarroaFiles(files []string) []string {
 	var clean []string
 	for _, e := range files {
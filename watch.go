@@ -0,0 +1,153 @@
+package propolis
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gitlab.com/catastrophic/assistance/flac"
+	"gitlab.com/catastrophic/assistance/logthis"
+	"gitlab.com/catastrophic/assistance/music"
+	"gitlab.com/catastrophic/assistance/strslice"
+	"gitlab.com/catastrophic/assistance/ui"
+)
+
+const (
+	// watchDebounce is how long to wait after the last change before checking the release again.
+	watchDebounce = time.Second
+)
+
+var (
+	imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif"}
+	// check groups depending on the source of the release, which can be guessed from rip files.
+	sourceDependentGroups = []string{TitleMusic, TitleFilenames, TitleFoldername, TitleSource, TitleDupes}
+)
+
+// fileEvent is a change in a watched release.
+type fileEvent struct {
+	path string
+	// structural changes create, remove or rename files.
+	structural bool
+}
+
+// affectedCheckGroups by a list of changes, by title.
+func affectedCheckGroups(events []fileEvent) map[string]bool {
+	affected := make(map[string]bool)
+	for _, e := range events {
+		ext := strings.ToLower(filepath.Ext(e.path))
+		switch {
+		case ext == flac.FlacExt || ext == mp3Ext:
+			for _, g := range checkGroups {
+				affected[g.title] = true
+			}
+		case e.structural:
+			for _, t := range []string{TitleOrganization, TitleArtwork, TitleFilenames, TitleExtraFiles, TitleFoldername, TitleSource} {
+				affected[t] = true
+			}
+			if strslice.Contains(ripExtensions, ext) {
+				for _, t := range sourceDependentGroups {
+					affected[t] = true
+				}
+			}
+		case strslice.Contains(imageExtensions, ext):
+			// folder covers are compared to the embedded artwork
+			affected[TitleExtraFiles] = true
+			affected[TitleArtwork] = true
+		default:
+			affected[TitleExtraFiles] = true
+		}
+		// any file can be listed in a checksum file or a torrent
+		affected[TitleChecksums] = true
+		affected[TitleTorrent] = true
+		affected[TitleTracker] = true
+	}
+	return affected
+}
+
+// analyseChangedGroups of checks again, reusing the previous results of the groups that were not affected by changes.
+// The release checks are always run again.
+func analyseChangedGroups(path, metadataDir string, options Options, version string, previous map[string][]*Check, affected map[string]bool) (*Propolis, map[string][]*Check) {
+	analysis := NewPropolis(path, music.NewWithExternalMetadata(path, metadataDir), options.ProblemsOnly)
+	defer analysis.Clear()
+	analysis.ToggleStdOutput(false)
+	defer analysis.ToggleStdOutput(true)
+	analysis.DisableChecks(options.DisabledChecks)
+	analysis.SetJobs(options.Jobs)
+	analysis.SetSource(options.Source)
+	if !options.DisableCache {
+		analysis.UseCache(CachePath(metadataDir, options.MetadataRoot), version)
+	}
+
+	results := make(map[string][]*Check)
+	results[TitleRelease] = analysis.runCheckGroup(releaseCheckGroup, options)
+	checks := results[TitleRelease]
+	for _, g := range analysis.checkGroups() {
+		if !g.enabledFor(options) {
+			continue
+		}
+		if old, ok := previous[g.title]; ok && !affected[g.title] {
+			results[g.title] = old
+		} else {
+			results[g.title] = analysis.runCheckGroup(g, options)
+		}
+		checks = append(checks, results[g.title]...)
+	}
+	if err := analysis.SaveCache(); err != nil {
+		logthis.Error(errors.Wrap(err, "could not save cache"), logthis.NORMAL)
+	}
+	analysis.Checks = checks
+	return analysis, results
+}
+
+// Watch a release, checking it again after its files change and showing which checks changed.
+// Spectrograms are not generated in this mode.
+func Watch(path string, options Options, version string) error {
+	logthis.Info(ui.YellowBold(ArrowHeader+"Watching "+path), logthis.NORMAL)
+	metadataDir := MetadataDir(path, options.MetadataRoot, options.Snatched)
+
+	analysis, results := analyseChangedGroups(path, metadataDir, options, version, nil, nil)
+	for _, c := range analysis.Checks {
+		if isProblem(c) {
+			logthis.Info(c.String(), logthis.NORMAL)
+		}
+	}
+	logthis.Info(ui.Blue(analysis.Summary()), logthis.NORMAL)
+
+	events := make(chan fileEvent, 100)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- watchFiles(path, events)
+	}()
+	var pending []fileEvent
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case err := <-watchErr:
+			return err
+		case e := <-events:
+			// ignoring what propolis writes in the release folder
+			if options.Snatched && strings.HasPrefix(e.path, metadataDir) {
+				continue
+			}
+			pending = append(pending, e)
+			timer.Reset(watchDebounce)
+		case <-timer.C:
+			updated, updatedResults := analyseChangedGroups(path, metadataDir, options, version, results, affectedCheckGroups(pending))
+			logthis.Info("\n"+titleHeader+ui.BlueBoldUnderlined(time.Now().Format("15:04:05")+" Files changed, checking again"), logthis.NORMAL)
+			var changed bool
+			for _, c := range diffChecks(analysis.Checks, updated.Checks) {
+				if c.resultChanged() {
+					logthis.Info(c.String(), logthis.NORMAL)
+					changed = true
+				}
+			}
+			if !changed {
+				logthis.Info(ui.Blue("No check changed."), logthis.NORMAL)
+			}
+			logthis.Info(ui.Blue(updated.Summary()), logthis.NORMAL)
+			analysis, results, pending = updated, updatedResults, nil
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package propolis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// watchFiles in root and its subfolders with inotify, sending changes until an error occurs.
+func watchFiles(root string, events chan<- fileEvent) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	watched := make(map[int]string)
+	addWatches := func(dir string) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return err
+			}
+			wd, err := unix.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				return err
+			}
+			watched[wd] = path
+			return nil
+		})
+	}
+	if err := addWatches(root); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(fd, buffer)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buffer[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			dir, ok := watched[int(event.Wd)]
+			if !ok || name == "" {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			structural := event.Mask&(unix.IN_CREATE|unix.IN_DELETE|unix.IN_MOVED_FROM|unix.IN_MOVED_TO) != 0
+			if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				// new subfolders are watched too, they might have disappeared already
+				_ = addWatches(path)
+			}
+			events <- fileEvent{path: path, structural: structural}
+		}
+	}
+}
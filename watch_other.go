@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package propolis
+
+import "errors"
+
+// watchFiles is only supported on Linux, with inotify.
+func watchFiles(root string, events chan<- fileEvent) error {
+	return errors.New("watch mode is only available on Linux")
+}
@@ -0,0 +1,64 @@
+package propolis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAffectedCheckGroups(t *testing.T) {
+	fmt.Println("+ Testing affectedCheckGroups...")
+	check := assert.New(t)
+
+	cases := []struct {
+		name        string
+		events      []fileEvent
+		affected    []string
+		notAffected []string
+	}{
+		{
+			name:        "no changes",
+			notAffected: []string{TitleMusic, TitleTags, TitleExtraFiles, TitleChecksums},
+		},
+		{
+			name:        "retagged track",
+			events:      []fileEvent{{path: "/release/01 - One.FLAC"}},
+			affected:    []string{TitleMusic, TitleTags, TitleArtwork, TitleFilenames, TitleFoldername, TitleChecksums},
+			notAffected: []string{TitleRelease},
+		},
+		{
+			name:        "edited cover",
+			events:      []fileEvent{{path: "/release/cover.jpg"}},
+			affected:    []string{TitleExtraFiles, TitleArtwork, TitleChecksums},
+			notAffected: []string{TitleMusic, TitleTags, TitleOrganization, TitleFilenames},
+		},
+		{
+			name:        "edited text file",
+			events:      []fileEvent{{path: "/release/info.txt"}},
+			affected:    []string{TitleExtraFiles, TitleChecksums},
+			notAffected: []string{TitleMusic, TitleTags, TitleArtwork, TitleOrganization, TitleFilenames, TitleFoldername},
+		},
+		{
+			name:        "new text file",
+			events:      []fileEvent{{path: "/release/info.txt", structural: true}},
+			affected:    []string{TitleOrganization, TitleArtwork, TitleFilenames, TitleExtraFiles, TitleFoldername, TitleChecksums},
+			notAffected: []string{TitleMusic, TitleTags},
+		},
+		{
+			name:        "several changes",
+			events:      []fileEvent{{path: "/release/info.txt"}, {path: "/release/folder.png"}},
+			affected:    []string{TitleExtraFiles, TitleArtwork, TitleChecksums},
+			notAffected: []string{TitleMusic, TitleTags, TitleOrganization},
+		},
+	}
+	for _, c := range cases {
+		affected := affectedCheckGroups(c.events)
+		for _, title := range c.affected {
+			check.True(affected[title], c.name+": "+title)
+		}
+		for _, title := range c.notAffected {
+			check.False(affected[title], c.name+": "+title)
+		}
+	}
+}